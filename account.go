@@ -1,8 +1,7 @@
 package monzo
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -42,7 +41,13 @@ const UKRetailJointAccount AccountType = "uk_retail_joint"
 // Balance returns the current balance for the Account that
 // it is called on.
 func (a Account) Balance() (Balance, error) {
-	req, err := a.client.NewRequest(http.MethodGet, "balance", nil)
+	return a.BalanceContext(context.Background())
+}
+
+// BalanceContext is like Balance but uses the passed context
+// for the request.
+func (a Account) BalanceContext(ctx context.Context) (Balance, error) {
+	req, err := a.client.NewRequestContext(ctx, http.MethodGet, "balance", nil)
 	if err != nil {
 		return Balance{}, err
 	}
@@ -51,26 +56,23 @@ func (a Account) Balance() (Balance, error) {
 	q.Add("account_id", a.ID)
 	req.URL.RawQuery = q.Encode()
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return Balance{}, fmt.Errorf("failed to fetch balance: %s", str)
-	}
-
 	var bal Balance
-	if err := json.Unmarshal(b.Bytes(), &bal); err != nil {
-		return Balance{}, err
+	if err := a.client.send(req, "", &bal); err != nil {
+		return Balance{}, fmt.Errorf("failed to fetch balance: %w", err)
 	}
 
 	return bal, nil
 }
 
+// Webhooks returns the webhooks registered against the Account.
 func (a Account) Webhooks() ([]Webhook, error) {
-	req, err := a.client.resourceRequest("webhooks")
+	return a.WebhooksContext(context.Background())
+}
+
+// WebhooksContext is like Webhooks but uses the passed context
+// for the request.
+func (a Account) WebhooksContext(ctx context.Context) ([]Webhook, error) {
+	req, err := a.client.resourceRequest(ctx, "webhooks")
 	if err != nil {
 		return nil, err
 	}
@@ -80,50 +82,49 @@ func (a Account) Webhooks() ([]Webhook, error) {
 
 	req.URL.RawQuery = q.Encode()
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch webhooks: %s", str)
+	var webhooks []Webhook
+	if err := a.client.send(req, "webhooks", &webhooks); err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
 	}
 
-	bytes := b.Bytes()
-	var webhooks []Webhook
-	if err := unwrapJSON(bytes, "webhooks", &webhooks); err != nil {
-		return nil, err
+	for i := range webhooks {
+		webhooks[i].client = a.client
 	}
 
 	return webhooks, nil
 }
 
-func (a Account) RegisterWebhook(webhook string) error {
+// RegisterWebhook asks Monzo to send events for the Account to
+// the given URL, returning the created Webhook.
+func (a Account) RegisterWebhook(webhook string) (Webhook, error) {
+	return a.RegisterWebhookContext(context.Background(), webhook)
+}
+
+// RegisterWebhookContext is like RegisterWebhook but uses the
+// passed context for the request.
+func (a Account) RegisterWebhookContext(ctx context.Context, webhook string) (Webhook, error) {
 	data := url.Values{}
 	data.Add("account_id", a.ID)
 	data.Add("url", webhook)
 
-	req, err := a.client.NewRequest(
+	req, err := a.client.NewRequestContext(
+		ctx,
 		http.MethodPost,
 		"webhooks",
 		strings.NewReader(data.Encode()),
 	)
 	if err != nil {
-		return err
+		return Webhook{}, err
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to create webhook: %s", str)
+	var created Webhook
+	if err := a.client.send(req, "webhook", &created); err != nil {
+		return Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
 	}
 
-	return nil
+	created.client = a.client
+
+	return created, nil
 }
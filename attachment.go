@@ -0,0 +1,137 @@
+package monzo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Attachment is a file, such as a photo of a receipt, that has
+// been attached to a Transaction.
+type Attachment struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	ExternalID string `json:"external_id"`
+	FileURL    string `json:"file_url"`
+	FileType   string `json:"file_type"`
+	Created    string `json:"created"`
+
+	client *Client
+}
+
+// Attach uploads the contents of r and attaches it to the
+// Transaction. Monzo hands out a URL to upload the file to,
+// which is then registered against the Transaction.
+func (t Transaction) Attach(r io.Reader, filename string, contentType string) (Attachment, error) {
+	return t.AttachContext(context.Background(), r, filename, contentType)
+}
+
+// AttachContext is like Attach but uses the passed context for
+// the requests.
+func (t Transaction) AttachContext(ctx context.Context, r io.Reader, filename string, contentType string) (Attachment, error) {
+	// The content length has to be known before the upload URL
+	// can be requested, so the file is read up front.
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	form := url.Values{}
+	form.Add("file_name", filename)
+	form.Add("file_type", contentType)
+	form.Add("content_length", strconv.Itoa(len(data)))
+
+	req, err := t.client.NewRequestContext(ctx, http.MethodPost, "attachment/upload", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	var upload struct {
+		FileURL   string `json:"file_url"`
+		UploadURL string `json:"upload_url"`
+	}
+	if err := t.client.send(req, "", &upload); err != nil {
+		return Attachment{}, fmt.Errorf("failed to request upload url: %w", err)
+	}
+
+	if err := t.client.upload(ctx, upload.UploadURL, data, contentType); err != nil {
+		return Attachment{}, fmt.Errorf("failed to upload attachment: %w", err)
+	}
+
+	form = url.Values{}
+	form.Add("external_id", t.ID)
+	form.Add("file_url", upload.FileURL)
+	form.Add("file_type", contentType)
+
+	req, err = t.client.NewRequestContext(ctx, http.MethodPost, "attachment/register", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	var attachment Attachment
+	if err := t.client.send(req, "attachment", &attachment); err != nil {
+		return Attachment{}, fmt.Errorf("failed to register attachment: %w", err)
+	}
+
+	attachment.client = t.client
+
+	return attachment, nil
+}
+
+// upload PUTs data to a URL handed out by Monzo. The URL is
+// already signed, so the request isn't given the access token.
+func (c *Client) upload(ctx context.Context, uploadURL string, data []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, body, err := c.doWithRetry(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp, body)
+	}
+
+	return nil
+}
+
+// Remove deregisters the Attachment from its Transaction.
+func (a Attachment) Remove() error {
+	return a.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove but uses the passed context for
+// the request.
+func (a Attachment) RemoveContext(ctx context.Context) error {
+	form := url.Values{}
+	form.Add("id", a.ID)
+
+	req, err := a.client.NewRequestContext(ctx, http.MethodPost, "attachment/deregister", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	if err := a.client.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to remove attachment: %w", err)
+	}
+
+	return nil
+}
@@ -8,3 +8,20 @@ type Balance struct {
 	WithSavings int `json:"balance_including_flexible_savings"`
 	Currency    Currency
 }
+
+// AvailableMoney returns the amount available to spend as Money.
+func (b Balance) AvailableMoney() Money {
+	return NewMoney(int64(b.Balance), b.Currency)
+}
+
+// TotalMoney returns the total balance, including money in
+// pots, as Money.
+func (b Balance) TotalMoney() Money {
+	return NewMoney(int64(b.Total), b.Currency)
+}
+
+// WithSavingsMoney returns the total balance, including money
+// in savings pots, as Money.
+func (b Balance) WithSavingsMoney() Money {
+	return NewMoney(int64(b.WithSavings), b.Currency)
+}
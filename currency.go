@@ -1,12 +1,123 @@
 package monzo
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Currency is a country code for a specific currency.
 type Currency string
 
 // Currencies that can be passed to the Monzo API.
 //
-// More will probably exist but haven't been tested.
+// Any ISO 4217 code is a valid Currency; these are just the
+// common ones.
 const (
 	CurrencyGBP Currency = "GBP"
 	CurrencyUSD Currency = "USD"
+	CurrencyEUR Currency = "EUR"
+	CurrencyJPY Currency = "JPY"
 )
+
+// ErrUnknownCurrency is returned when a currency code isn't in
+// ISO 4217.
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// CurrencyInfo describes a currency in ISO 4217.
+type CurrencyInfo struct {
+	Code    Currency
+	Numeric int
+
+	// Exponent is the number of decimal places in the minor
+	// unit, such as 2 for GBP and 0 for JPY.
+	Exponent int
+
+	// Symbol is empty for currencies that are written with
+	// their code.
+	Symbol string
+	Name   string
+}
+
+var (
+	currenciesByCode    = make(map[Currency]CurrencyInfo, len(iso4217))
+	currenciesByNumeric = make(map[int]CurrencyInfo, len(iso4217))
+)
+
+func init() {
+	for _, ci := range iso4217 {
+		currenciesByCode[ci.Code] = ci
+		currenciesByNumeric[ci.Numeric] = ci
+	}
+}
+
+// symbolCurrencies maps the symbols accepted by ParseMoney back
+// to their currency. Only symbols that are commonly written
+// alone are included.
+var symbolCurrencies = map[string]Currency{
+	"£": CurrencyGBP,
+	"$": CurrencyUSD,
+	"€": CurrencyEUR,
+	"¥": CurrencyJPY,
+}
+
+// Currencies returns every currency in the registry, ordered by
+// code.
+func Currencies() []CurrencyInfo {
+	return append([]CurrencyInfo(nil), iso4217...)
+}
+
+// LookupCurrency returns the registry entry for an ISO 4217 code
+// such as "GBP", or a numeric code such as "826".
+func LookupCurrency(code string) (CurrencyInfo, bool) {
+	code = strings.TrimSpace(code)
+
+	if n, err := strconv.Atoi(code); err == nil {
+		ci, ok := currenciesByNumeric[n]
+		return ci, ok
+	}
+
+	ci, ok := currenciesByCode[Currency(strings.ToUpper(code))]
+	return ci, ok
+}
+
+// ParseCurrency returns the Currency for an ISO 4217 code, in
+// any case, or numeric code.
+func ParseCurrency(s string) (Currency, error) {
+	ci, ok := LookupCurrency(s)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, s)
+	}
+
+	return ci.Code, nil
+}
+
+// Valid reports whether c is a currency in ISO 4217.
+func (c Currency) Valid() bool {
+	_, ok := currenciesByCode[c]
+	return ok
+}
+
+// Exponent returns the number of decimal places in the
+// currency's minor unit, such as 2 for GBP and 0 for JPY.
+// Unknown currencies are assumed to have two.
+func (c Currency) Exponent() int {
+	if ci, ok := currenciesByCode[c]; ok {
+		return ci.Exponent
+	}
+
+	return 2
+}
+
+// Symbol returns the currency's symbol, such as "£" for GBP, or
+// an empty string if it doesn't have one.
+func (c Currency) Symbol() string {
+	return currenciesByCode[c].Symbol
+}
+
+// Name returns the currency's name, such as "Pound Sterling", or
+// an empty string for unknown currencies.
+func (c Currency) Name() string {
+	return currenciesByCode[c].Name
+}
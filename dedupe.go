@@ -0,0 +1,256 @@
+package monzo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoDedupeID is returned by a DedupeStore that has no dedupe
+// ID saved for a key.
+var ErrNoDedupeID = errors.New("no dedupe ID stored")
+
+// ErrIntentAmount is returned when an intent saved in a
+// DedupeStore is used again with a different amount.
+var ErrIntentAmount = errors.New("intent was saved with a different amount")
+
+// DedupeOption sets the dedupe ID that Monzo uses to recognise a
+// Deposit or Withdrawal it has already made.
+type DedupeOption func(*dedupe)
+
+type dedupe struct {
+	id     string
+	intent string
+}
+
+// WithDedupeID uses the given dedupe ID. It can't be combined
+// with WithIntent.
+func WithDedupeID(id string) DedupeOption {
+	return func(d *dedupe) {
+		d.id = id
+	}
+}
+
+// WithIntent derives the dedupe ID from the account, the pot,
+// the amount and an ID for what the caller means to do, such as
+// "rent-2024-03". Creating the same operation again, for example
+// after a crash, gives the same dedupe ID, so Monzo only moves
+// the money once.
+//
+// If the Client has a DedupeStore, the dedupe ID and amount first
+// used for an intent are saved, and the dedupe ID is reused. Using
+// the intent again with a different amount returns an error
+// wrapping ErrIntentAmount, rather than moving the wrong amount or
+// moving the money twice. WithIntent can't be combined with
+// WithDedupeID.
+func WithIntent(intent string) DedupeOption {
+	return func(d *dedupe) {
+		d.intent = intent
+	}
+}
+
+// DedupeStore saves the dedupe IDs used for each intent, along
+// with the amount, so that a job that is restarted reuses them.
+// It also records which dedupe IDs have been run, so that a
+// PotResult can report a replay.
+//
+// The store treats what it saves as opaque: the Client encodes
+// the amount alongside the dedupe ID itself.
+type DedupeStore interface {
+	// Load returns the record saved for key, or ErrNoDedupeID.
+	Load(ctx context.Context, key string) (string, error)
+
+	// Save records the dedupe ID, or other record, for key.
+	Save(ctx context.Context, key, id string) error
+}
+
+// WithDedupeStore saves the dedupe IDs of deposits and
+// withdrawals made WithIntent in store. It also records each
+// dedupe ID that is run, so that PotResult.Replayed can be
+// reported; without a store, Replayed is always false.
+func WithDedupeStore(store DedupeStore) Option {
+	return func(c *Client) {
+		c.dedupes = store
+	}
+}
+
+// dedupeID works out the dedupe ID for moving amt in or out of a
+// pot. op tells deposits and withdrawals apart.
+func (c *Client) dedupeID(ctx context.Context, op, accountID, potID string, amt int, opts []DedupeOption) (string, error) {
+	var d dedupe
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	if d.intent == "" {
+		if d.id != "" {
+			return d.id, nil
+		}
+		return randomDedupeID()
+	}
+
+	if d.id != "" {
+		return "", errors.New("WithDedupeID and WithIntent can't be used together")
+	}
+
+	key := op + ":" + accountID + ":" + potID + ":" + d.intent
+
+	if c.dedupes != nil {
+		record, err := c.dedupes.Load(ctx, key)
+		if err == nil {
+			return intentID(record, d.intent, amt)
+		}
+		if !errors.Is(err, ErrNoDedupeID) {
+			return "", fmt.Errorf("failed to load dedupe ID: %w", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(key + ":" + strconv.Itoa(amt)))
+	id := hex.EncodeToString(sum[:16])
+
+	if c.dedupes != nil {
+		if err := c.dedupes.Save(ctx, key, strconv.Itoa(amt)+":"+id); err != nil {
+			return "", fmt.Errorf("failed to save dedupe ID: %w", err)
+		}
+	}
+
+	return id, nil
+}
+
+// intentID returns the dedupe ID from a record saved for an
+// intent, which holds the amount it was first used with and the
+// dedupe ID, checking the amount hasn't changed.
+func intentID(record, intent string, amt int) (string, error) {
+	i := strings.Index(record, ":")
+	if i < 0 {
+		return "", fmt.Errorf("failed to load dedupe ID: invalid record %q", record)
+	}
+
+	saved, err := strconv.Atoi(record[:i])
+	if err != nil {
+		return "", fmt.Errorf("failed to load dedupe ID: invalid record %q", record)
+	}
+
+	if saved != amt {
+		return "", fmt.Errorf("%w: intent %q was saved for %d, not %d", ErrIntentAmount, intent, saved, amt)
+	}
+
+	return record[i+1:], nil
+}
+
+// runKey is the key a successful run of a dedupe ID is recorded
+// under in a DedupeStore.
+func runKey(id string) string {
+	return "run:" + id
+}
+
+// hasRun reports whether a request with the dedupe ID has been
+// sent successfully before. Runs are only recorded when the
+// Client has a DedupeStore.
+func (c *Client) hasRun(ctx context.Context, id string) bool {
+	if c.dedupes == nil {
+		return false
+	}
+
+	_, err := c.dedupes.Load(ctx, runKey(id))
+	return err == nil
+}
+
+// markRun records that a request with the dedupe ID has been sent
+// successfully.
+func (c *Client) markRun(ctx context.Context, id string) error {
+	if c.dedupes == nil {
+		return nil
+	}
+
+	if err := c.dedupes.Save(ctx, runKey(id), id); err != nil {
+		return fmt.Errorf("failed to save dedupe ID: %w", err)
+	}
+
+	return nil
+}
+
+// randomDedupeID returns a new random dedupe ID.
+func randomDedupeID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate dedupe ID: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryDedupeStore keeps dedupe IDs in memory. They are lost
+// when the process exits.
+type MemoryDedupeStore struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// NewMemoryDedupeStore creates an empty MemoryDedupeStore.
+func NewMemoryDedupeStore() *MemoryDedupeStore {
+	return &MemoryDedupeStore{ids: make(map[string]string)}
+}
+
+// Load returns the dedupe ID saved for key.
+func (s *MemoryDedupeStore) Load(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.ids[key]
+	if !ok {
+		return "", ErrNoDedupeID
+	}
+
+	return id, nil
+}
+
+// Save records the dedupe ID used for key.
+func (s *MemoryDedupeStore) Save(ctx context.Context, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ids[key] = id
+	return nil
+}
+
+// FileDedupeStore keeps dedupe IDs in a JSON file, which
+// processes can share.
+type FileDedupeStore struct {
+	path string
+}
+
+// NewFileDedupeStore creates a FileDedupeStore that keeps its
+// dedupe IDs at path.
+func NewFileDedupeStore(path string) *FileDedupeStore {
+	return &FileDedupeStore{path: path}
+}
+
+// Load returns the dedupe ID saved for key.
+func (s *FileDedupeStore) Load(ctx context.Context, key string) (string, error) {
+	ids := make(map[string]string)
+	if err := readJSONFile(s.path, &ids); err != nil {
+		return "", err
+	}
+
+	id, ok := ids[key]
+	if !ok {
+		return "", ErrNoDedupeID
+	}
+
+	return id, nil
+}
+
+// Save records the dedupe ID used for key.
+func (s *FileDedupeStore) Save(ctx context.Context, key, id string) error {
+	ids := make(map[string]string)
+	return updateJSONFile(ctx, s.path, &ids, func() {
+		ids[key] = id
+	})
+}
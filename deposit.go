@@ -1,8 +1,7 @@
 package monzo
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"net/http"
 )
 
@@ -11,23 +10,49 @@ import (
 // deposit is not ran.
 type Deposit struct {
 	Request *http.Request
-	Client  *http.Client
+
+	// Client sends the request when the Deposit wasn't created
+	// by an Account.
+	//
+	// Deprecated: create the Deposit with Account.Deposit, which
+	// uses the Account's Client.
+	Client *http.Client
+
+	// DedupeID is the dedupe ID sent with the request.
+	DedupeID string
+
+	client *Client
 }
 
-// Run executes the deposit against the Monzo API. An error is
-// only returned if the deposit fails to run. If the deposit
-// has already ran against the account, it is not ran again
-// and an error is not returned.
-func (d Deposit) Run() error {
-	resp, _ := d.Client.Do(d.Request)
+// Run executes the deposit against the Monzo API, returning the
+// Pot as it is afterwards. An error is only returned if the
+// deposit fails to run. If the deposit has already ran against
+// the account, it is not ran again and an error is not returned.
+//
+// Run can be called again, for example after an error, and sends
+// the same request each time.
+func (d Deposit) Run() (*PotResult, error) {
+	return d.RunContext(context.Background())
+}
 
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
+// RunContext is like Run but uses the passed context for the
+// request.
+func (d Deposit) RunContext(ctx context.Context) (*PotResult, error) {
+	return potClient(d.client, d.Client).runPotRequest(ctx, d.Request, d.DedupeID, "deposit")
+}
+
+// potClient returns the Client to run a Deposit or Withdrawal
+// with, falling back to the deprecated http.Client field for ones
+// that were built by hand.
+func potClient(c *Client, hc *http.Client) *Client {
+	if c != nil {
+		return c
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch accounts: %s", str)
+	fallback := &Client{}
+	if hc != nil {
+		fallback.Client = *hc
 	}
 
-	return nil
+	return fallback
 }
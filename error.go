@@ -0,0 +1,91 @@
+package monzo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNotFound is returned when a resource that was asked for by
+// ID, such as an Account or a Pot, doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// APIError is returned when Monzo responds to a request with an
+// unsuccessful status code. Monzo's JSON error body is decoded
+// into it where possible; the raw body is kept in Body either
+// way.
+type APIError struct {
+	StatusCode int
+	Code       string                 `json:"code"`
+	Message    string                 `json:"message"`
+	Params     map[string]interface{} `json:"params"`
+	RequestID  string                 `json:"-"`
+	Body       string                 `json:"-"`
+}
+
+// newAPIError builds an APIError from a response whose body has
+// already been read.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Body:       string(body),
+	}
+
+	// Not every error Monzo returns has a JSON body, so failing
+	// to decode it isn't an error in itself.
+	json.Unmarshal(body, e)
+
+	return e
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("monzo: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+	}
+
+	return fmt.Sprintf("monzo: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsNotFound reports whether err was caused by a missing
+// resource, either from Monzo or from ErrNotFound.
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err was caused by Monzo
+// rejecting the access token.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsRateLimited reports whether err was caused by Monzo rate
+// limiting the client.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsSCARequired reports whether err was caused by the user not
+// yet having approved access in the Monzo app. Monzo requires
+// Strong Customer Authentication before most endpoints can be
+// used with a new access token.
+func IsSCARequired(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		return false
+	}
+
+	return apiErr.Code == "forbidden.insufficient_permissions" ||
+		strings.HasPrefix(apiErr.Code, "forbidden.verification_required")
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
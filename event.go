@@ -0,0 +1,67 @@
+package monzo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventTransactionCreated is the type of event Monzo sends when
+// a transaction is created on an account.
+const EventTransactionCreated = "transaction.created"
+
+// EventTransactionUpdated is the type of event Account.Watch
+// sends when a transaction it has already seen changes.
+const EventTransactionUpdated = "transaction.updated"
+
+// Event is a notification about an account, as sent by Monzo to
+// a webhook.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+
+	// Received is when the event arrived.
+	Received time.Time `json:"received"`
+
+	// Changes lists the fields of the Transaction that changed,
+	// by their JSON names, for EventTransactionUpdated events
+	// sent by Account.Watch.
+	Changes []string `json:"changes,omitempty"`
+
+	// Transaction is decoded from Data for events about a
+	// transaction, whose types start with "transaction.".
+	Transaction Transaction `json:"-"`
+}
+
+// isTransactionEvent reports whether events of the given type
+// carry a Transaction.
+func isTransactionEvent(eventType string) bool {
+	return strings.HasPrefix(eventType, "transaction.")
+}
+
+// UnmarshalJSON decodes an Event, and the Transaction in it if
+// it has one.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	// The alias type stops this method from being called again.
+	type event Event
+	var out event
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+
+	*e = Event(out)
+
+	if out.Type == "" {
+		return errors.New("event has no type")
+	}
+
+	if isTransactionEvent(e.Type) && len(e.Data) > 0 {
+		if err := json.Unmarshal(e.Data, &e.Transaction); err != nil {
+			return fmt.Errorf("failed to decode %s event: %w", e.Type, err)
+		}
+	}
+
+	return nil
+}
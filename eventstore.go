@@ -0,0 +1,377 @@
+package monzo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventStore is an append-only log of the Events received from
+// Monzo. Monzo delivers an event again if it isn't acknowledged
+// in time, so the store drops events it has already recorded.
+//
+// The store also records which events have been queued to be
+// handled. An event that was recorded but couldn't be queued,
+// because the WebhookHandler was busy, is handled when Monzo
+// delivers it again, even if that delivery reaches another
+// process sharing the store.
+type EventStore interface {
+	// Append records e, reporting false if an event with the
+	// same DedupeKey has already been recorded.
+	Append(ctx context.Context, e Event) (bool, error)
+
+	// MarkQueued records that e has been queued to be handled.
+	MarkQueued(ctx context.Context, e Event) error
+
+	// Queued reports whether an event with the same DedupeKey
+	// as e has been marked as queued.
+	Queued(ctx context.Context, e Event) (bool, error)
+
+	// Replay calls fn with each event received at or after since,
+	// in the order they were recorded. It stops at the first
+	// error fn returns.
+	Replay(ctx context.Context, since time.Time, fn EventFunc) error
+}
+
+// DedupeKey identifies an event across deliveries: the event type
+// with the ID of its transaction for transaction.created events,
+// or with a hash of its data for others. A transaction can be
+// updated more than once, so each update is told apart by what
+// it holds.
+func (e Event) DedupeKey() string {
+	if e.Type == EventTransactionCreated && e.Transaction.ID != "" {
+		return e.Type + ":" + e.Transaction.ID
+	}
+
+	sum := sha256.Sum256(e.Data)
+	return e.Type + ":" + hex.EncodeToString(sum[:])
+}
+
+// MemoryEventStore keeps Events in memory. It is lost when the
+// process exits.
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events []Event
+
+	// keys maps the key of each recorded event to whether it
+	// has been queued.
+	keys map[string]bool
+}
+
+// NewMemoryEventStore creates an empty MemoryEventStore.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{keys: make(map[string]bool)}
+}
+
+// Append records e unless it has been recorded already.
+func (s *MemoryEventStore) Append(ctx context.Context, e Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := e.DedupeKey()
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+
+	s.keys[key] = false
+	s.events = append(s.events, e)
+
+	return true, nil
+}
+
+// MarkQueued records that e has been queued.
+func (s *MemoryEventStore) MarkQueued(ctx context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[e.DedupeKey()] = true
+	return nil
+}
+
+// Queued reports whether e has been marked as queued.
+func (s *MemoryEventStore) Queued(ctx context.Context, e Event) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.keys[e.DedupeKey()], nil
+}
+
+// Replay calls fn with the events received since the given time.
+func (s *MemoryEventStore) Replay(ctx context.Context, since time.Time, fn EventFunc) error {
+	s.mu.Lock()
+	events := make([]Event, len(s.events))
+	copy(events, s.events)
+	s.mu.Unlock()
+
+	return replay(ctx, events, since, fn)
+}
+
+func replay(ctx context.Context, events []Event, since time.Time, fn EventFunc) error {
+	for _, e := range events {
+		if e.Received.Before(since) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileEventStore keeps Events in a file, one JSON object per
+// line, so that they survive a restart. Processes can share a
+// file: appends are serialised with a lock file. Queued events
+// are marked with a line of their own.
+//
+// Lines that can't be decoded, such as one left part-written by
+// a crash, are skipped.
+type FileEventStore struct {
+	path string
+
+	mu sync.Mutex
+
+	// keys maps the key of each recorded event to whether it
+	// has been queued.
+	keys   map[string]bool
+	offset int64
+}
+
+// queuedLine is the line that marks an event as queued.
+type queuedLine struct {
+	Queued string `json:"queued"`
+}
+
+// NewFileEventStore creates a FileEventStore that keeps its
+// events at path. The file is created on the first Append.
+func NewFileEventStore(path string) *FileEventStore {
+	return &FileEventStore{
+		path: path,
+		keys: make(map[string]bool),
+	}
+}
+
+// Append records e at the end of the file, unless it has been
+// recorded already. The file is synced before Append returns.
+func (s *FileEventStore) Append(ctx context.Context, e Event) (bool, error) {
+	fresh := false
+	err := s.update(ctx, func() ([]byte, error) {
+		if _, ok := s.keys[e.DedupeKey()]; ok {
+			return nil, nil
+		}
+
+		fresh = true
+		return json.Marshal(e)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return fresh, nil
+}
+
+// MarkQueued records that e has been queued at the end of the
+// file. The file is synced before MarkQueued returns.
+func (s *FileEventStore) MarkQueued(ctx context.Context, e Event) error {
+	key := e.DedupeKey()
+
+	return s.update(ctx, func() ([]byte, error) {
+		if s.keys[key] {
+			return nil, nil
+		}
+
+		return json.Marshal(queuedLine{Queued: key})
+	})
+}
+
+// Queued reports whether e has been marked as queued, by this
+// or any other process sharing the file.
+func (s *FileEventStore) Queued(ctx context.Context, e Event) (bool, error) {
+	queued := false
+	err := s.update(ctx, func() ([]byte, error) {
+		queued = s.keys[e.DedupeKey()]
+		return nil, nil
+	})
+
+	return queued, err
+}
+
+// update locks the file and reads any lines appended since it
+// was last read, then writes the line returned by fn, if any.
+// The keys are only ever updated by reading the file, so a line
+// written here is picked up by the next update.
+func (s *FileEventStore) update(ctx context.Context, fn func() ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(ctx, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	// Pick up anything appended since the file was last read,
+	// including by other processes.
+	terminated, err := s.scan(f)
+	if err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+
+	line, err := fn()
+	if err != nil || line == nil {
+		return err
+	}
+
+	// A crash part way through a write leaves a line with no
+	// newline, which mustn't be joined onto this one.
+	if !terminated {
+		line = append([]byte("\n"), line...)
+	}
+	line = append(line, '\n')
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+
+	return nil
+}
+
+// scan reads the keys of the events appended to f since it was
+// last scanned, reporting whether the file ends with a newline.
+func (s *FileEventStore) scan(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	size := info.Size()
+	if size < s.offset {
+		// The file has been replaced, so start again.
+		s.keys = make(map[string]bool)
+		s.offset = 0
+	}
+
+	if size > s.offset {
+		r := io.NewSectionReader(f, s.offset, size-s.offset)
+		err := eachLine(r, func(e *Event, queued string) error {
+			if e != nil {
+				if _, ok := s.keys[e.DedupeKey()]; !ok {
+					s.keys[e.DedupeKey()] = false
+				}
+				return nil
+			}
+
+			s.keys[queued] = true
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+
+		s.offset = size
+	}
+
+	if size == 0 {
+		return true, nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return false, err
+	}
+
+	return last[0] == '\n', nil
+}
+
+// Replay calls fn with the events in the file received since the
+// given time.
+func (s *FileEventStore) Replay(ctx context.Context, since time.Time, fn EventFunc) error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	return eachEvent(f, func(e Event) error {
+		if e.Received.Before(since) {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return fn(ctx, e)
+	})
+}
+
+// eachEvent calls fn with each event in a JSON lines log.
+func eachEvent(r io.Reader, fn func(Event) error) error {
+	return eachLine(r, func(e *Event, queued string) error {
+		if e == nil {
+			return nil
+		}
+
+		return fn(*e)
+	})
+}
+
+// eachLine calls fn for each line in a JSON lines log, with
+// either the event on the line or the key of the event the line
+// marks as queued.
+func eachLine(r io.Reader, fn func(e *Event, queued string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*maxEventSize)
+
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var q queuedLine
+		if err := json.Unmarshal(line, &q); err == nil && q.Queued != "" {
+			if err := fn(nil, q.Queued); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+
+		if err := fn(&e, ""); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
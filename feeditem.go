@@ -1,7 +1,7 @@
 package monzo
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -71,6 +71,12 @@ func (fi *FeedItem) BodyColor(hex string) *FeedItem {
 // AddFeedItem adds a passed FeedItem to the Monzo Account to
 // display in the feed.
 func (a Account) AddFeedItem(fi *FeedItem) error {
+	return a.AddFeedItemContext(context.Background(), fi)
+}
+
+// AddFeedItemContext is like AddFeedItem but uses the passed
+// context for the request.
+func (a Account) AddFeedItemContext(ctx context.Context, fi *FeedItem) error {
 	endpoint := "/feed"
 	data := url.Values{}
 	data.Add("account_id", a.ID)
@@ -91,21 +97,15 @@ func (a Account) AddFeedItem(fi *FeedItem) error {
 		data.Add("params[body_color]", fi.bodyColor)
 	}
 
-	req, err := a.client.NewRequest(http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	req, err := a.client.NewRequestContext(ctx, http.MethodPost, endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to add metadata: %s", str)
+	if err := a.client.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to add feed item: %w", err)
 	}
 
 	return nil
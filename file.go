@@ -0,0 +1,120 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPoll is how often a held lock is checked.
+const lockPoll = 25 * time.Millisecond
+
+// lockFile takes an exclusive lock on path, using path.lock,
+// waiting for any other holder to release it. The returned func
+// releases the lock.
+//
+// Where the platform supports it the lock is taken by the
+// operating system, so it is released if the holder crashes and
+// is never taken from a holder that is still running.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	lock := path + ".lock"
+
+	for {
+		unlock, ok, err := tryLockFile(lock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		if ok {
+			return unlock, nil
+		}
+
+		if err := sleep(ctx, lockPoll); err != nil {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+	}
+}
+
+// writeFileAtomic replaces the contents of path with data. The
+// data is written to a temporary file in the same directory and
+// renamed over path, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// readJSONFile decodes the JSON in path into v, leaving v as it
+// is if there is no file yet.
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// updateJSONFile reads the JSON in path into v, calls update to
+// change it, and writes it back. Processes can share the file:
+// updates are serialised with lockFile and written with
+// writeFileAtomic, so none are lost and readers never see a
+// partial write.
+func updateJSONFile(ctx context.Context, path string, v interface{}, update func()) error {
+	unlock, err := lockFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := readJSONFile(path, v); err != nil {
+		return err
+	}
+
+	update()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,141 @@
+package monzo
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// maxPageSize is the most transactions Monzo returns at once.
+const maxPageSize = 100
+
+// TransactionQuery describes the transactions that a
+// TransactionIterator pages through. The zero value covers every
+// transaction on the account.
+type TransactionQuery struct {
+	// Since only includes transactions created at or after the
+	// given time.
+	Since time.Time
+
+	// SinceID only includes transactions created after the one
+	// with the given ID. It takes precedence over Since.
+	SinceID string
+
+	// Before only includes transactions created before the
+	// given time.
+	Before time.Time
+
+	// PageSize is how many transactions are fetched per request.
+	// It defaults to, and can't be more than, 100.
+	PageSize int
+}
+
+// TransactionIterator lazily pages through an Account's
+// transactions, oldest first. It is used like a bufio.Scanner:
+//
+//	it := acc.TransactionIterator(monzo.TransactionQuery{})
+//	for it.Next(ctx) {
+//		tx := it.Transaction()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TransactionIterator struct {
+	acc   Account
+	query TransactionQuery
+
+	// cursor is the ID of the last transaction fetched, which
+	// Monzo uses as the start of the next page.
+	cursor string
+	page   []Transaction
+	cur    Transaction
+	done   bool
+	err    error
+}
+
+// TransactionIterator returns an iterator over the transactions
+// matching q. Nothing is fetched until Next is called.
+func (a Account) TransactionIterator(q TransactionQuery) *TransactionIterator {
+	if q.PageSize <= 0 || q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	return &TransactionIterator{
+		acc:    a,
+		query:  q,
+		cursor: q.SinceID,
+	}
+}
+
+// Next advances to the next transaction, fetching another page
+// when the current one runs out. It returns false when there
+// are no more transactions, the context is done or a request
+// fails; Err tells these apart.
+func (it *TransactionIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if err := ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	if len(it.page) == 0 {
+		if it.done || !it.fetch(ctx) {
+			return false
+		}
+	}
+
+	it.cur = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// fetch loads the next page, reporting whether it has any
+// transactions in it.
+func (it *TransactionIterator) fetch(ctx context.Context) bool {
+	params := make(map[string]string)
+	params["limit"] = strconv.Itoa(it.query.PageSize)
+
+	if it.cursor != "" {
+		params["since"] = it.cursor
+	} else if !it.query.Since.IsZero() {
+		params["since"] = it.query.Since.Format(time.RFC3339)
+	}
+
+	if !it.query.Before.IsZero() {
+		params["before"] = it.query.Before.Format(time.RFC3339)
+	}
+
+	txs, err := it.acc.getTransactions(ctx, params)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	// A short page means Monzo has nothing more to send, so
+	// there's no need to ask for another.
+	if len(txs) < it.query.PageSize {
+		it.done = true
+	}
+
+	if len(txs) == 0 {
+		return false
+	}
+
+	it.cursor = txs[len(txs)-1].ID
+	it.page = txs
+	return true
+}
+
+// Transaction returns the transaction Next advanced to.
+func (it *TransactionIterator) Transaction() Transaction {
+	return it.cur
+}
+
+// Err returns the error that stopped the iterator, if any. It
+// returns nil once every transaction has been read.
+func (it *TransactionIterator) Err() error {
+	return it.err
+}
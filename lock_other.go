@@ -0,0 +1,51 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package monzo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+)
+
+// osLocks reports whether file locks are held by the OS. A lock left behind by a crash stays until it is removed.
+const osLocks = false
+
+// tryLockFile creates the lock file without waiting, reporting
+// false if it already exists. The file holds a token that is
+// checked before it is removed, so a holder never removes a lock
+// it doesn't own. Locks are never taken from another holder, so
+// one left behind by a crash must be removed by hand.
+func tryLockFile(lock string) (func(), bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, false, err
+	}
+	token := []byte(hex.EncodeToString(b))
+
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = f.Write(token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(lock)
+		return nil, false, err
+	}
+
+	return func() {
+		if held, err := ioutil.ReadFile(lock); err == nil && bytes.Equal(held, token) {
+			os.Remove(lock)
+		}
+	}, true, nil
+}
@@ -0,0 +1,38 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package monzo
+
+import (
+	"os"
+	"syscall"
+)
+
+// osLocks reports whether file locks are held by the OS, so they are released when their holder exits.
+const osLocks = true
+
+// tryLockFile takes an flock on the lock file without waiting,
+// reporting false if another holder has it. The file is left in
+// place when the lock is released: removing it would let a new
+// holder lock a fresh file while a waiter locks the old one.
+func tryLockFile(lock string) (func(), bool, error) {
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, true, nil
+}
@@ -0,0 +1,57 @@
+package monzo
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// osLocks reports whether file locks are held by the OS, so they are released when their holder exits.
+const osLocks = true
+
+// tryLockFile takes a LockFileEx lock on the lock file without
+// waiting, reporting false if another holder has it. The file is
+// left in place when the lock is released.
+func tryLockFile(lock string) (func(), bool, error) {
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately,
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&ol)),
+	)
+	if r == 0 {
+		f.Close()
+
+		if err == errorLockViolation {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return func() {
+		var ol syscall.Overlapped
+		procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+		f.Close()
+	}, true, nil
+}
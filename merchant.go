@@ -1,7 +1,91 @@
 package monzo
 
-// Merchant is WIP.
-// TODO: Finish this.
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Merchant is where a card Transaction took place. Monzo only
+// sends the full merchant when transactions are fetched with
+// the merchant expanded, which this package always asks for.
+// Otherwise only the ID is set.
 type Merchant struct {
-	Merchant string
+	ID       string          `json:"id"`
+	GroupID  string          `json:"group_id"`
+	Name     string          `json:"name"`
+	Logo     string          `json:"logo"`
+	Emoji    string          `json:"emoji"`
+	Category string          `json:"category"`
+	Online   bool            `json:"online"`
+	ATM      bool            `json:"atm"`
+	Created  string          `json:"created"`
+	Address  MerchantAddress `json:"address"`
+
+	// Metadata holds extra details Monzo knows about the
+	// merchant, such as its website and Twitter handle.
+	Metadata map[string]string `json:"metadata"`
+}
+
+// MerchantAddress is the location of a Merchant.
+type MerchantAddress struct {
+	Address        string  `json:"address"`
+	City           string  `json:"city"`
+	Region         string  `json:"region"`
+	Country        string  `json:"country"`
+	Postcode       string  `json:"postcode"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Formatted      string  `json:"formatted"`
+	ShortFormatted string  `json:"short_formatted"`
+	Approximate    bool    `json:"approximate"`
+}
+
+// Website returns the merchant's website, if Monzo knows it.
+func (m Merchant) Website() string {
+	return m.Metadata["website"]
+}
+
+// Twitter returns the merchant's Twitter handle, if Monzo
+// knows it.
+func (m Merchant) Twitter() string {
+	return m.Metadata["twitter_id"]
+}
+
+// UnmarshalJSON accepts either a full merchant object or the
+// bare merchant ID that Monzo sends when the merchant isn't
+// expanded.
+func (m *Merchant) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		*m = Merchant{}
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		*m = Merchant{}
+		return json.Unmarshal(data, &m.ID)
+	}
+
+	// The alias type stops this method from being called again.
+	// Monzo's metadata values aren't always strings, so they
+	// are decoded loosely and anything else is dropped.
+	type merchant Merchant
+	var out struct {
+		merchant
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+
+	*m = Merchant(out.merchant)
+	m.Metadata = make(map[string]string)
+	for k, v := range out.Metadata {
+		if s, ok := v.(string); ok {
+			m.Metadata[k] = s
+		}
+	}
+
+	return nil
 }
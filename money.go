@@ -0,0 +1,295 @@
+package monzo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrCurrencyMismatch is returned when two amounts of Money in
+// different currencies are combined or compared.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Money is an amount in the minor units of a Currency, such as
+// pence for GBP or cents for USD. Currencies without minor
+// units, such as JPY, are counted in whole units.
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// NewMoney creates Money from an amount in minor units.
+func NewMoney(amount int64, currency Currency) Money {
+	return Money{
+		Amount:   amount,
+		Currency: currency,
+	}
+}
+
+// Add returns the sum of m and o, which must be in the same
+// currency.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("adding %s to %s overflows", o, m)
+	}
+
+	return Money{sum, m.Currency}, nil
+}
+
+// Sub returns m minus o, which must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	neg, err := o.Neg()
+	if err != nil {
+		return Money{}, fmt.Errorf("subtracting %s from %s overflows", o, m)
+	}
+
+	return m.Add(neg)
+}
+
+// Neg returns m with its sign flipped. The smallest amount,
+// math.MinInt64, has no positive counterpart, so negating it is
+// an error.
+func (m Money) Neg() (Money, error) {
+	if m.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("negating %s overflows", m)
+	}
+
+	return Money{-m.Amount, m.Currency}, nil
+}
+
+// Cmp compares m with o, which must be in the same currency. It
+// returns -1 if m is less than o, 0 if they are equal and +1 if
+// m is more than o.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether m is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	return nil
+}
+
+// String formats m for the en-GB locale, such as "£12.34" or
+// "-$0.50". Currencies without a symbol are formatted with
+// their code, such as "12.34 CHF".
+func (m Money) String() string {
+	return m.Format("en-GB")
+}
+
+// moneyLocale describes how amounts are written in a locale.
+type moneyLocale struct {
+	decimal string
+	group   string
+
+	// symbolAfter puts the symbol after the amount, separated
+	// by a space, as in "12,34 €".
+	symbolAfter bool
+}
+
+var moneyLocales = map[string]moneyLocale{
+	"en-GB": {decimal: ".", group: ","},
+	"en-US": {decimal: ".", group: ","},
+	"en-IE": {decimal: ".", group: ","},
+	"ja-JP": {decimal: ".", group: ","},
+	"de-DE": {decimal: ",", group: ".", symbolAfter: true},
+	"es-ES": {decimal: ",", group: ".", symbolAfter: true},
+	"it-IT": {decimal: ",", group: ".", symbolAfter: true},
+	"nl-NL": {decimal: ",", group: ".", symbolAfter: true},
+	"fr-FR": {decimal: ",", group: " ", symbolAfter: true},
+	"de-CH": {decimal: ".", group: "’", symbolAfter: true},
+}
+
+// Format formats m for a locale such as "en-GB" or "de-DE",
+// using the locale's separators and symbol placement. Unknown
+// locales are formatted as en-GB.
+func (m Money) Format(locale string) string {
+	l, ok := moneyLocales[strings.Replace(locale, "_", "-", 1)]
+	if !ok {
+		l = moneyLocales["en-GB"]
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+
+	// Work with the absolute value as an unsigned number so
+	// that math.MinInt64 doesn't overflow.
+	abs := uint64(amount)
+	if amount < 0 {
+		abs = uint64(-(amount + 1)) + 1
+	}
+
+	exp := m.Currency.Exponent()
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	whole, frac := digits[:len(digits)-exp], digits[len(digits)-exp:]
+
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(r)
+	}
+
+	if exp > 0 {
+		b.WriteString(l.decimal)
+		b.WriteString(frac)
+	}
+
+	symbol := m.Currency.Symbol()
+	switch {
+	case symbol == "":
+		return sign + b.String() + " " + string(m.Currency)
+	case l.symbolAfter:
+		return sign + b.String() + " " + symbol
+	}
+
+	return sign + symbol + b.String()
+}
+
+// ParseMoney parses amounts such as "£12.34", "-$1,000",
+// "12.34 GBP" and "GBP 12.34". The amount can't have more
+// decimal places than the currency has minor units.
+func ParseMoney(s string) (Money, error) {
+	str := strings.TrimSpace(s)
+
+	neg := false
+	if strings.HasPrefix(str, "-") {
+		neg = true
+		str = strings.TrimSpace(str[1:])
+	}
+
+	var currency Currency
+	for sym, c := range symbolCurrencies {
+		if strings.HasPrefix(str, sym) {
+			currency = c
+			str = strings.TrimSpace(str[len(sym):])
+			break
+		}
+	}
+
+	if currency == "" {
+		fields := strings.Fields(str)
+		if len(fields) != 2 {
+			return Money{}, fmt.Errorf("cannot parse %q as money: missing currency", s)
+		}
+
+		code, num := fields[1], fields[0]
+		if isCurrencyCode(fields[0]) {
+			code, num = fields[0], fields[1]
+		}
+
+		c, err := ParseCurrency(code)
+		if err != nil {
+			return Money{}, fmt.Errorf("cannot parse %q as money: %w", s, err)
+		}
+
+		currency = c
+		str = num
+	}
+
+	if strings.HasPrefix(str, "-") && !neg {
+		neg = true
+		str = str[1:]
+	}
+
+	amount, err := parseMinorUnits(str, currency.Exponent())
+	if err != nil {
+		return Money{}, fmt.Errorf("cannot parse %q as money: %w", s, err)
+	}
+
+	if neg {
+		amount = -amount
+	}
+
+	return Money{amount, currency}, nil
+}
+
+// parseMinorUnits parses a decimal number such as "1,234.56"
+// into minor units with the given exponent. Commas are only
+// accepted between groups of three digits in the whole part.
+func parseMinorUnits(s string, exp int) (int64, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	if strings.Contains(whole, ",") {
+		groups := strings.Split(whole, ",")
+		for i, g := range groups {
+			if (i == 0 && (len(g) == 0 || len(g) > 3)) || (i > 0 && len(g) != 3) {
+				return 0, fmt.Errorf("misplaced thousands separator in %q", s)
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+
+	if whole == "" && frac == "" {
+		return 0, errors.New("missing amount")
+	}
+
+	if len(frac) > exp {
+		return 0, fmt.Errorf("too many decimal places, expected at most %d", exp)
+	}
+
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid character %q", r)
+		}
+	}
+
+	return strconv.ParseInt(digits, 10, 64)
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,26 +1,35 @@
 package monzo
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // APIBase is the root of the Monzo API.
 const APIBase string = "https://api.monzo.com"
 
 // Client is the way to interact with the Monzo API.
+//
+// Requests are authorized with Token, unless a TokenSource has
+// been set with WithTokenSource.
 type Client struct {
 	Token string
 
+	tokens      TokenSource
+	baseURL     string
+	userAgent   string
+	retryPolicy RetryPolicy
+	dedupes     DedupeStore
+	transfers   TransferStore
+
 	http.Client
 }
 
@@ -28,31 +37,44 @@ type Client struct {
 // No validation is done on this method so users should call
 // the Ping method after creating a client to ensure that
 // the new connection has been created successsfully.
-func NewClient(token string) *Client {
-	return &Client{
-		Token: token,
+//
+// Options can be passed to change how the client talks to
+// Monzo, such as pointing it at a different base URL.
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
+		Token:       token,
+		baseURL:     APIBase,
+		retryPolicy: DefaultRetryPolicy,
+		transfers:   NewMemoryTransferStore(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
 }
 
 // Ping attempts to connect to the Monzo API using the given
 // client.
 func (c *Client) Ping() error {
-	if c.Token == "" {
+	return c.PingContext(context.Background())
+}
+
+// PingContext is like Ping but uses the passed context for
+// the request.
+func (c *Client) PingContext(ctx context.Context) error {
+	if c.Token == "" && c.tokens == nil {
 		return errors.New("error pinging Monzo API. Client token cannot be empty")
 	}
 
-	req, err := c.NewRequest(http.MethodGet, "ping/whoami", nil)
+	req, err := c.NewRequestContext(ctx, http.MethodGet, "ping/whoami", nil)
 	if err != nil {
 		return err
 	}
 
-	resp, _ := c.Do(req)
-
-	if resp.StatusCode != http.StatusOK {
-		b := new(bytes.Buffer)
-		b.ReadFrom(resp.Body)
-		str := b.String()
-		return fmt.Errorf("error pinging Monzo API. JSON response: %s", str)
+	if err := c.send(req, "", nil); err != nil {
+		return fmt.Errorf("error pinging Monzo API: %w", err)
 	}
 
 	return nil
@@ -61,17 +83,180 @@ func (c *Client) Ping() error {
 // NewRequest creates an *http.Request with some Monzo-specific
 // sensible defaults, such as Authorization headers.
 func (c *Client) NewRequest(method string, endpoint string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, APIBase+"/"+endpoint, body)
+	return c.NewRequestContext(context.Background(), method, endpoint, body)
+}
+
+// NewRequestContext is like NewRequest but attaches the passed
+// context to the request, so that cancellation and deadlines
+// are honored when it is sent.
+func (c *Client) NewRequestContext(ctx context.Context, method string, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.url(endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	token, err := c.accessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.Token)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
 	return req, nil
 }
 
-func (c *Client) resourceRequest(resource string) (*http.Request, error) {
-	req, err := c.NewRequest(http.MethodGet, resource, nil)
+// accessToken returns the token to authorize a request with.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	if c.tokens == nil {
+		return c.Token, nil
+	}
+
+	tok, err := c.tokens.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	return tok.AccessToken, nil
+}
+
+// url joins the endpoint onto the client's base URL. Endpoints
+// are accepted with or without a leading slash. Clients that
+// weren't created with NewClient fall back to APIBase.
+func (c *Client) url(endpoint string) string {
+	base := c.baseURL
+	if base == "" {
+		base = APIBase
+	}
+
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(endpoint, "/")
+}
+
+// send executes req and decodes a successful response into v.
+// If wrapper is not empty, the response is unwrapped using
+// unwrapJSON before decoding. v can be nil when the caller
+// doesn't need the response body.
+//
+// Transport failures are returned as-is, and responses with an
+// unsuccessful status code are returned as an *APIError. Both
+// are retried according to the Client's RetryPolicy.
+func (c *Client) send(req *http.Request, wrapper string, v interface{}) error {
+	resp, body, err := c.doWithRetry(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		if next, ok := c.reauthorize(req); ok {
+			resp, body, err = c.doWithRetry(next)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp, body)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if wrapper == "" {
+		return json.Unmarshal(body, v)
+	}
+
+	return unwrapJSON(body, wrapper, v)
+}
+
+// doWithRetry sends req, retrying it as the RetryPolicy allows.
+// The response that is returned has already had its body read
+// and closed.
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, []byte, error) {
+	p := c.retryPolicy
+
+	for attempt := 1; ; attempt++ {
+		resp, body, err := c.roundTrip(req)
+		if attempt >= p.MaxAttempts || !p.shouldRetry(req, resp, err) {
+			return resp, body, err
+		}
+
+		wait := p.backoff(attempt+1, resp)
+
+		if p.OnRetry != nil {
+			ra := RetryAttempt{
+				Request: req,
+				Attempt: attempt + 1,
+				Err:     err,
+				Wait:    wait,
+			}
+			if resp != nil {
+				ra.StatusCode = resp.StatusCode
+			}
+			p.OnRetry(ra)
+		}
+
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, nil, err
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// reauthorize refreshes an access token that Monzo has rejected,
+// returning a copy of req that carries the new token. It reports
+// false if the TokenSource can't refresh or the refresh failed,
+// in which case the original 401 is returned to the caller.
+func (c *Client) reauthorize(req *http.Request) (*http.Request, bool) {
+	r, ok := c.tokens.(tokenRefresher)
+	if !ok {
+		return nil, false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil, false
+	}
+
+	stale := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	tok, err := r.refresh(req.Context(), stale)
+	if err != nil {
+		return nil, false
+	}
+
+	next, err := rewind(req)
+	if err != nil {
+		return nil, false
+	}
+
+	next.Header = req.Header.Clone()
+	next.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return next, true
+}
+
+// roundTrip sends req once, reading and closing the body.
+func (c *Client) roundTrip(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
+
+func (c *Client) resourceRequest(ctx context.Context, resource string) (*http.Request, error) {
+	req, err := c.NewRequestContext(ctx, http.MethodGet, resource, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +267,13 @@ func (c *Client) resourceRequest(resource string) (*http.Request, error) {
 // Account returns a single Account from the Monzo API. If the
 // account is not found (does not exist), an error is returned.
 func (c *Client) Account(id string) (Account, error) {
-	accs, err := c.accounts()
+	return c.AccountContext(context.Background(), id)
+}
+
+// AccountContext is like Account but uses the passed context
+// for the request.
+func (c *Client) AccountContext(ctx context.Context, id string) (Account, error) {
+	accs, err := c.accounts(ctx)
 	if err != nil {
 		return Account{}, err
 	}
@@ -96,35 +287,30 @@ func (c *Client) Account(id string) (Account, error) {
 		}
 	}
 
-	return Account{}, fmt.Errorf("no account found with ID %s", id)
+	return Account{}, fmt.Errorf("no account found with ID %s: %w", id, ErrNotFound)
 }
 
 // Accounts returns a slice of Account structs, one for each of
 // the Monzo accounts associated with the authentication.
 func (c *Client) Accounts() ([]Account, error) {
-	return c.accounts()
+	return c.accounts(context.Background())
+}
+
+// AccountsContext is like Accounts but uses the passed context
+// for the request.
+func (c *Client) AccountsContext(ctx context.Context) ([]Account, error) {
+	return c.accounts(ctx)
 }
 
-func (c *Client) accounts() ([]Account, error) {
-	req, err := c.resourceRequest("accounts")
+func (c *Client) accounts(ctx context.Context) ([]Account, error) {
+	req, err := c.resourceRequest(ctx, "accounts")
 	if err != nil {
 		return nil, err
 	}
 
-	resp, _ := c.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch accounts: %s", str)
-	}
-
-	bytes := b.Bytes()
 	var accounts []Account
-	if err := unwrapJSON(bytes, "accounts", &accounts); err != nil {
-		return nil, err
+	if err := c.send(req, "accounts", &accounts); err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
 	}
 
 	var accs []Account
@@ -149,51 +335,128 @@ func (c *Client) accounts() ([]Account, error) {
 // to ensure that the request is idempotent, so the deposit is
 // not ran when it is created. To action the deposit, call
 // the `Run` method on it.
-func (a Account) Deposit(p Pot, amt int) (*Deposit, error) {
-	endpoint := "/pots/" + p.ID + "/deposit"
+//
+// A random dedupe ID is used unless one is set with a
+// DedupeOption, such as WithIntent.
+func (a Account) Deposit(p Pot, amt int, opts ...DedupeOption) (*Deposit, error) {
+	return a.DepositContext(context.Background(), p, amt, opts...)
+}
 
-	data := url.Values{}
-	data.Add("source_account_id", a.ID)
-	data.Add("amount", strconv.Itoa(amt))
+// DepositContext is like Deposit but uses the passed context to
+// load and save the dedupe ID. The deposit is sent with the
+// context passed to RunContext.
+func (a Account) DepositContext(ctx context.Context, p Pot, amt int, opts ...DedupeOption) (*Deposit, error) {
+	req, id, err := a.potRequest(ctx, "deposit", "source_account_id", p, amt, opts)
+	if err != nil {
+		return &Deposit{}, err
+	}
 
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
+	return &Deposit{Request: req, Client: &a.client.Client, DedupeID: id, client: a.client}, nil
+}
 
-	data.Add("dedupe_id", strconv.FormatFloat(r.Float64(), 'f', 6, 64))
+// DepositMoney is like Deposit but takes the amount as Money,
+// which must be in the same currency as the Pot.
+func (a Account) DepositMoney(p Pot, m Money, opts ...DedupeOption) (*Deposit, error) {
+	return a.DepositMoneyContext(context.Background(), p, m, opts...)
+}
 
-	req, err := a.client.NewRequest(http.MethodPut, endpoint, strings.NewReader(data.Encode()))
-	if err != nil {
-		return &Deposit{}, err
+// DepositMoneyContext is like DepositMoney but uses the passed
+// context to load and save the dedupe ID.
+func (a Account) DepositMoneyContext(ctx context.Context, p Pot, m Money, opts ...DedupeOption) (*Deposit, error) {
+	if p.Currency != "" && m.Currency != p.Currency {
+		return &Deposit{}, fmt.Errorf("cannot deposit %s into a %s pot: %w", m, p.Currency, ErrCurrencyMismatch)
 	}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return a.DepositContext(ctx, p, int(m.Amount), opts...)
+}
+
+// WithdrawMoney is like Withdraw but takes the amount as Money,
+// which must be in the same currency as the Pot.
+func (a Account) WithdrawMoney(p Pot, m Money, opts ...DedupeOption) (*Withdrawal, error) {
+	return a.WithdrawMoneyContext(context.Background(), p, m, opts...)
+}
+
+// WithdrawMoneyContext is like WithdrawMoney but uses the passed
+// context to load and save the dedupe ID.
+func (a Account) WithdrawMoneyContext(ctx context.Context, p Pot, m Money, opts ...DedupeOption) (*Withdrawal, error) {
+	if p.Currency != "" && m.Currency != p.Currency {
+		return &Withdrawal{}, fmt.Errorf("cannot withdraw %s from a %s pot: %w", m, p.Currency, ErrCurrencyMismatch)
+	}
 
-	return &Deposit{req, &a.client.Client}, nil
+	return a.WithdrawContext(ctx, p, int(m.Amount), opts...)
 }
 
 // Withdraw creates a new Withdrawal struct. Monzo uses a 'dedupe_id'
 // to ensure that the request is idempotent, so the withdrawal is
 // not ran when it is created. To action the withdrawal, call
 // the `Run` method on it.
-func (a Account) Withdraw(p Pot, amt int) (*Withdrawal, error) {
-	endpoint := "/pots/" + p.ID + "/withdraw"
+//
+// A random dedupe ID is used unless one is set with a
+// DedupeOption, such as WithIntent.
+func (a Account) Withdraw(p Pot, amt int, opts ...DedupeOption) (*Withdrawal, error) {
+	return a.WithdrawContext(context.Background(), p, amt, opts...)
+}
+
+// WithdrawContext is like Withdraw but uses the passed context to
+// load and save the dedupe ID. The withdrawal is sent with the
+// context passed to RunContext.
+func (a Account) WithdrawContext(ctx context.Context, p Pot, amt int, opts ...DedupeOption) (*Withdrawal, error) {
+	req, id, err := a.potRequest(ctx, "withdraw", "destination_account_id", p, amt, opts)
+	if err != nil {
+		return &Withdrawal{}, err
+	}
+
+	return &Withdrawal{Request: req, Client: &a.client.Client, DedupeID: id, client: a.client}, nil
+}
+
+// potRequest builds the request to move amt in or out of a pot,
+// returning it with the dedupe ID it uses. op is the endpoint,
+// and accountField the name the account's ID is sent under.
+func (a Account) potRequest(ctx context.Context, op, accountField string, p Pot, amt int, opts []DedupeOption) (*http.Request, string, error) {
+	id, err := a.client.dedupeID(ctx, op, a.ID, p.ID, amt, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
 	data := url.Values{}
-	data.Add("destination_account_id", a.ID)
+	data.Add(accountField, a.ID)
 	data.Add("amount", strconv.Itoa(amt))
+	data.Add("dedupe_id", id)
 
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
+	req, err := a.client.NewRequestContext(ctx, http.MethodPut, "/pots/"+p.ID+"/"+op, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	data.Add("dedupe_id", strconv.FormatFloat(r.Float64(), 'f', 6, 64))
+	return req, id, nil
+}
 
-	req, err := a.client.NewRequest(http.MethodPut, endpoint, strings.NewReader(data.Encode()))
+// runPotRequest sends a request built by potRequest, which may
+// have been sent before. verb describes it in errors.
+func (c *Client) runPotRequest(ctx context.Context, req *http.Request, id, verb string) (*PotResult, error) {
+	// The body is read each time the request is sent, so send a
+	// copy with a fresh one.
+	req, err := rewind(req.WithContext(ctx))
 	if err != nil {
-		return &Withdrawal{}, err
+		return nil, err
 	}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	replayed := c.hasRun(ctx, id)
 
-	return &Withdrawal{req, &a.client.Client}, nil
+	var p Pot
+	if err := c.send(req, "", &p); err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", verb, err)
+	}
+
+	if !replayed {
+		if err := c.markRun(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PotResult{Pot: p, DedupeID: id, Replayed: replayed}, nil
 }
 
 // unwrapJSON takes a JSON response and unmarshals the contents
@@ -206,7 +469,12 @@ func unwrapJSON(data []byte, wrapper string, v interface{}) error {
 		return err
 	}
 
-	if err := json.Unmarshal(*objmap[wrapper], v); err != nil {
+	raw, ok := objmap[wrapper]
+	if !ok || raw == nil {
+		return fmt.Errorf("response is missing the %q key", wrapper)
+	}
+
+	if err := json.Unmarshal(*raw, v); err != nil {
 		return err
 	}
 
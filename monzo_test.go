@@ -1,8 +1,22 @@
 package monzo
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/tmus/monzo/monzotest"
 )
 
 func TestPing(t *testing.T) {
@@ -20,3 +34,1848 @@ func TestPing(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestClientOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/accounts" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		if ua := r.Header.Get("User-Agent"); ua != "monzo-test" {
+			t.Errorf("expected user agent monzo-test, got %q", ua)
+		}
+
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("expected bearer token, got %q", auth)
+		}
+
+		fmt.Fprint(w, `{"accounts": [{"id": "acc_1", "type": "uk_retail"}]}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient("token",
+		WithBaseURL(srv.URL+"/"),
+		WithUserAgent("monzo-test"),
+		WithTimeout(time.Second),
+	)
+
+	accs, err := c.Accounts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(accs) != 1 || accs[0].ID != "acc_1" {
+		t.Fatalf("expected account acc_1, got %+v", accs)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req_1")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"code": "forbidden.insufficient_permissions", "message": "Access forbidden due to insufficient permissions", "params": {"client_id": "oauth2client_1"}}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient("token", WithBaseURL(srv.URL))
+
+	_, err := c.Pots()
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "forbidden.insufficient_permissions" {
+		t.Errorf("unexpected status or code: %d %s", apiErr.StatusCode, apiErr.Code)
+	}
+
+	if apiErr.RequestID != "req_1" || apiErr.Params["client_id"] != "oauth2client_1" {
+		t.Errorf("unexpected request id or params: %s %v", apiErr.RequestID, apiErr.Params)
+	}
+
+	if !IsSCARequired(err) || IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("helpers misreported error %v", err)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pots": [{"id": "pot_1"}]}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient("token", WithBaseURL(srv.URL))
+
+	if _, err := c.Pot("pot_2"); !errors.Is(err, ErrNotFound) || !IsNotFound(err) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	c := NewClient("token", WithBaseURL(srv.URL), WithRetryPolicy(RetryPolicy{}))
+
+	if _, err := c.Accounts(); err == nil {
+		t.Fatal("expected an error when the server is unreachable. Didn't get one")
+	}
+}
+
+func TestContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClient("token", WithBaseURL(srv.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.AccountsContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if err := c.PingContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMissingWrapper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"something_else": []}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient("token", WithBaseURL(srv.URL))
+
+	if _, err := c.Accounts(); err == nil {
+		t.Fatal("expected an error when the accounts key is missing. Didn't get one")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusInternalServerError)
+		case calls == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case calls == 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `{"pots": []}`)
+		}
+	}))
+	defer srv.Close()
+
+	var retries []RetryAttempt
+	c := NewClient("token", WithBaseURL(srv.URL), WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		OnRetry: func(ra RetryAttempt) {
+			retries = append(retries, ra)
+		},
+	}))
+
+	if _, err := c.Pots(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(retries) != 2 || retries[0].StatusCode != http.StatusTooManyRequests || retries[1].Attempt != 3 {
+		t.Fatalf("unexpected retries: %+v", retries)
+	}
+
+	// Webhook registration is a POST, so a server error must not
+	// be retried in case Monzo actioned it.
+	calls = 0
+	acc := Account{ID: "acc_1", client: c}
+	if _, err := acc.RegisterWebhook("https://example.com"); err == nil {
+		t.Fatal("expected an error from the webhook registration. Didn't get one")
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected the POST to be sent once, sent %d times", calls)
+	}
+}
+
+func TestOAuthRefresh(t *testing.T) {
+	var refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2/token":
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != fmt.Sprintf("refresh_%d", refreshes) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			refreshes++
+			fmt.Fprintf(w, `{"access_token": "access_%d", "refresh_token": "refresh_%d", "expires_in": 3600}`, refreshes, refreshes)
+		case "/ping/whoami":
+			// The first refreshed token is revoked server-side,
+			// so it is rejected and must be refreshed again.
+			if r.Header.Get("Authorization") != "Bearer access_2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			fmt.Fprint(w, `{"authenticated": true}`)
+		}
+	}))
+	defer srv.Close()
+
+	conf := &OAuthConfig{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL + "/oauth2/token",
+	}
+
+	expired := &Token{
+		AccessToken:  "access_0",
+		RefreshToken: "refresh_0",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+
+	c := NewClient("", WithBaseURL(srv.URL), WithTokenSource(conf.TokenSource(expired)))
+
+	if err := c.Ping(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if refreshes != 2 {
+		t.Fatalf("expected two refreshes, got %d", refreshes)
+	}
+
+	u := conf.AuthCodeURL("state_1")
+	if u != "https://auth.monzo.com/?client_id=client&redirect_uri=&response_type=code&state=state_1" {
+		t.Errorf("unexpected auth code url %s", u)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	var mu sync.Mutex
+	var refreshes int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		r.ParseForm()
+		if r.Form.Get("refresh_token") != "refresh_0" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code": "bad_request.invalid_grant"}`)
+			return
+		}
+
+		refreshes++
+		fmt.Fprint(w, `{"access_token": "access_1", "refresh_token": "refresh_1", "expires_in": 3600}`)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	conf := &OAuthConfig{TokenURL: srv.URL}
+
+	ctx := context.Background()
+	if err := NewPassphraseFileTokenStore(path, "hunter2").Save(ctx, &Token{
+		AccessToken:  "access_0",
+		RefreshToken: "refresh_0",
+		Expiry:       time.Now().Add(-time.Hour),
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Each source gets its own store, as if they were running in
+	// separate processes sharing the file.
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ts := conf.StoredTokenSource(NewPassphraseFileTokenStore(path, "hunter2"))
+			tok, err := ts.Token(ctx)
+			if err == nil && tok.AccessToken != "access_1" {
+				err = fmt.Errorf("expected access_1, got %s", tok.AccessToken)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if refreshes != 1 {
+		t.Fatalf("expected the refresh token to be used once, used %d times", refreshes)
+	}
+
+	if _, err := NewPassphraseFileTokenStore(path, "wrong").Load(ctx); err == nil {
+		t.Fatal("expected an error loading with the wrong passphrase. Didn't get one")
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	srv := monzotest.NewServer("token")
+	defer srv.Close()
+
+	seeded := srv.AddAccount(monzotest.Account{Balance: 10000})
+	pot := srv.AddPot(monzotest.Pot{Name: "Savings", AccountID: seeded.ID})
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		srv.AddTransaction(monzotest.Transaction{
+			AccountID: seeded.ID,
+			Amount:    -100,
+			Created:   start.Add(time.Duration(i) * time.Hour),
+			Settled:   start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	c := NewClient("token", WithBaseURL(srv.URL))
+	if err := c.Ping(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acc, err := c.Account(seeded.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := c.Pot(pot.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d, _ := acc.Deposit(p, 2000)
+	if _, err := d.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wd, _ := acc.Withdraw(p, 500)
+	if _, err := wd.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bal, err := acc.Balance()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bal.Balance != 10000-300-2000+500 || bal.Total != 10000-300 {
+		t.Fatalf("unexpected balance %+v", bal)
+	}
+
+	txs, err := acc.TransactionsSince(start.Add(time.Hour), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(txs) != 1 || !txs[0].Created.Equal(start.Add(time.Hour)) {
+		t.Fatalf("unexpected transactions %+v", txs)
+	}
+
+	if err := txs[0].Note("lunch"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tx, _ := srv.Transaction(txs[0].ID); tx.Notes != "lunch" {
+		t.Fatalf("expected the note to be saved, got %q", tx.Notes)
+	}
+
+	if err := acc.AddFeedItem(MakeFeedItem("Hello", "World")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if items := srv.FeedItems(acc.ID); len(items) != 1 || items[0].Params["title"] != "Hello" {
+		t.Fatalf("unexpected feed items %+v", items)
+	}
+}
+
+// newTestAccount starts a fake Monzo server with the seeded
+// account on it, and returns a Client for the server along with
+// the account as the Client sees it. The caller closes the server.
+func newTestAccount(t *testing.T, seed monzotest.Account, opts ...Option) (*monzotest.Server, *Client, Account) {
+	t.Helper()
+
+	srv := monzotest.NewServer("token")
+	seeded := srv.AddAccount(seed)
+
+	c := NewClient("token", append([]Option{WithBaseURL(srv.URL)}, opts...)...)
+
+	acc, err := c.Account(seeded.ID)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("failed to fetch the test account: %v", err)
+	}
+
+	return srv, c, acc
+}
+
+func TestTransactionIterator(t *testing.T) {
+	srv, _, acc := newTestAccount(t, monzotest.Account{})
+	defer srv.Close()
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 250; i++ {
+		srv.AddTransaction(monzotest.Transaction{
+			AccountID: acc.ID,
+			Amount:    int64(i),
+			Created:   start.Add(time.Duration(i) * time.Minute),
+			Settled:   start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	txs, err := acc.TransactionsBetween(start.Add(10*time.Minute), start.Add(240*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(txs) != 230 || txs[0].Amount != 10 || txs[229].Amount != 239 {
+		t.Fatalf("expected transactions 10 to 239, got %d", len(txs))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	it := acc.TransactionIterator(TransactionQuery{PageSize: 10})
+
+	var n int
+	for it.Next(ctx) {
+		if n++; n == 25 {
+			cancel()
+		}
+	}
+
+	if n != 25 || !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("expected to stop after 25 transactions with context.Canceled, stopped after %d with %v", n, it.Err())
+	}
+}
+
+func TestMerchant(t *testing.T) {
+	var tx struct {
+		Expanded Merchant
+		Bare     Merchant
+	}
+
+	err := json.Unmarshal([]byte(`{
+		"expanded": {
+			"id": "merch_1",
+			"group_id": "grp_1",
+			"name": "The De Beauvoir Deli Co.",
+			"emoji": "🍞",
+			"address": {"city": "London", "latitude": 51.5, "longitude": -0.08},
+			"metadata": {"website": "https://example.com", "twitter_id": "deli", "created_for_merchant": 1}
+		},
+		"bare": "merch_2"
+	}`), &tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := tx.Expanded
+	if m.ID != "merch_1" || m.GroupID != "grp_1" || m.Address.City != "London" || m.Address.Latitude != 51.5 {
+		t.Errorf("unexpected merchant %+v", m)
+	}
+
+	if m.Website() != "https://example.com" || m.Twitter() != "deli" {
+		t.Errorf("unexpected merchant metadata %v", m.Metadata)
+	}
+
+	if tx.Bare.ID != "merch_2" || tx.Bare.Name != "" {
+		t.Errorf("unexpected bare merchant %+v", tx.Bare)
+	}
+}
+
+func TestTransactionModel(t *testing.T) {
+	srv, c, acc := newTestAccount(t, monzotest.Account{Balance: 1000})
+	defer srv.Close()
+
+	pot := srv.AddPot(monzotest.Pot{AccountID: acc.ID})
+
+	pending, _ := srv.AddTransaction(monzotest.Transaction{
+		AccountID:     acc.ID,
+		Amount:        -450,
+		LocalAmount:   -500,
+		LocalCurrency: "EUR",
+		Category:      "eating_out",
+		Merchant:      &monzotest.Merchant{Name: "Café"},
+	})
+	declined, _ := srv.AddTransaction(monzotest.Transaction{
+		AccountID:     acc.ID,
+		Amount:        -10000,
+		DeclineReason: "INSUFFICIENT_FUNDS",
+	})
+	srv.AddTransaction(monzotest.Transaction{
+		AccountID:    acc.ID,
+		Amount:       2500,
+		Settled:      time.Now(),
+		Counterparty: &monzotest.Counterparty{Name: "Tom", SortCode: "040004", AccountNumber: "12345678"},
+	})
+
+	p, _ := c.Pot(pot.ID)
+
+	d, _ := acc.Deposit(p, 100)
+	if _, err := d.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	txs, err := acc.Transactions(100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(txs) != 4 {
+		t.Fatalf("expected 4 transactions, got %d", len(txs))
+	}
+
+	tx := txs[0]
+	if tx.ID != pending.ID || !tx.IsPending() || !tx.Settled.IsZero() {
+		t.Errorf("expected %s to be pending, got %+v", pending.ID, tx)
+	}
+
+	if tx.LocalAmount != -500 || tx.LocalCurrency != "EUR" || tx.AccountBalance != 550 {
+		t.Errorf("unexpected amounts on %+v", tx)
+	}
+
+	if tx.Categories["eating_out"] != -450 || tx.Merchant.Name != "Café" {
+		t.Errorf("unexpected category or merchant on %+v", tx)
+	}
+
+	if tx = txs[1]; tx.ID != declined.ID || !tx.IsDeclined() || tx.IsPending() {
+		t.Errorf("expected %s to be declined, got %+v", declined.ID, tx)
+	}
+
+	if tx = txs[2]; tx.Counterparty.Name != "Tom" || tx.Counterparty.SortCode != "040004" || tx.IsPending() {
+		t.Errorf("unexpected counterparty on %+v", tx)
+	}
+
+	if tx = txs[3]; !tx.IsPotTransfer() || tx.Metadata["pot_id"] != pot.ID || tx.DedupeID == "" {
+		t.Errorf("expected a pot transfer, got %+v", tx)
+	}
+}
+
+func TestMoney(t *testing.T) {
+	parsed := map[string]Money{
+		"£12.34":        {1234, CurrencyGBP},
+		"-£0.05":        {-5, CurrencyGBP},
+		"$1,000":        {100000, CurrencyUSD},
+		"12.34 GBP":     {1234, CurrencyGBP},
+		"EUR 9.9":       {990, CurrencyEUR},
+		"¥500":          {500, CurrencyJPY},
+		"1.234 kwd":     {1234, "KWD"},
+		"-1234.50 USD":  {-123450, CurrencyUSD},
+		"1,234,567 GBP": {123456700, CurrencyGBP},
+	}
+
+	for s, want := range parsed {
+		got, err := ParseMoney(s)
+		if err != nil || got != want {
+			t.Errorf("ParseMoney(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"12.34", "£12.345", "¥5.5", "£1x", "£1,2,3", "£,123", "£1234,567", "£1.2,3", "£1,23.45"} {
+		if _, err := ParseMoney(s); err == nil {
+			t.Errorf("expected an error parsing %q. Didn't get one", s)
+		}
+	}
+
+	if _, err := NewMoney(math.MinInt64, CurrencyGBP).Neg(); err == nil {
+		t.Error("expected an error negating the smallest amount")
+	}
+
+	if neg, err := NewMoney(250, CurrencyGBP).Neg(); err != nil || neg != NewMoney(-250, CurrencyGBP) {
+		t.Errorf("unexpected negation %v, %v", neg, err)
+	}
+
+	formatted := []struct {
+		m      Money
+		locale string
+		want   string
+	}{
+		{Money{123456, CurrencyGBP}, "en-GB", "£1,234.56"},
+		{Money{-5, CurrencyUSD}, "en-US", "-$0.05"},
+		{Money{123456, CurrencyEUR}, "de-DE", "1.234,56 €"},
+		{Money{1500000, CurrencyJPY}, "ja-JP", "¥1,500,000"},
+		{Money{1234, "CHF"}, "en-GB", "12.34 CHF"},
+	}
+
+	for _, f := range formatted {
+		if got := f.m.Format(f.locale); got != f.want {
+			t.Errorf("%#v.Format(%q) = %q, want %q", f.m, f.locale, got, f.want)
+		}
+	}
+
+	gbp, usd := NewMoney(100, CurrencyGBP), NewMoney(100, CurrencyUSD)
+	if _, err := gbp.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch adding GBP to USD, got %v", err)
+	}
+
+	sum, err := gbp.Add(NewMoney(50, CurrencyGBP))
+	if err != nil || sum != NewMoney(150, CurrencyGBP) {
+		t.Errorf("unexpected sum %v, %v", sum, err)
+	}
+
+	if cmp, _ := gbp.Cmp(sum); cmp != -1 {
+		t.Errorf("expected %v to be less than %v", gbp, sum)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	for _, s := range []string{"GBP", "gbp", "826"} {
+		if c, err := ParseCurrency(s); err != nil || c != CurrencyGBP {
+			t.Errorf("ParseCurrency(%q) = %v, %v, want GBP", s, c, err)
+		}
+	}
+
+	if _, err := ParseCurrency("XYZ"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("expected ErrUnknownCurrency for XYZ, got %v", err)
+	}
+
+	if ci, ok := LookupCurrency("KWD"); !ok || ci.Exponent != 3 || ci.Numeric != 414 {
+		t.Errorf("unexpected KWD entry %+v", ci)
+	}
+
+	r := MakeReceipt("order-1")
+	r.AddItem(MakeReceiptItem("Coffee", 250, "XYZ"))
+	if _, err := json.Marshal(r); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("expected ErrUnknownCurrency marshalling a receipt in XYZ, got %v", err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	srv, _, acc := newTestAccount(t, monzotest.Account{})
+	defer srv.Close()
+
+	seededTx, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -1200})
+
+	tx, _ := acc.Transaction(seededTx.ID)
+
+	att, err := tx.Attach(strings.NewReader("%PDF-1.4"), "invoice.pdf", "application/pdf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored := srv.Attachments(tx.ID)
+	if len(stored) != 1 || string(stored[0].Data) != "%PDF-1.4" || stored[0].FileType != "application/pdf" {
+		t.Fatalf("expected the upload to be registered, got %+v", stored)
+	}
+
+	tx, _ = acc.Transaction(tx.ID)
+	if atts := tx.Attachments; len(atts) != 1 || atts[0].ID != att.ID {
+		t.Fatalf("expected attachment %s on the transaction, got %+v", att.ID, atts)
+	}
+
+	// Attachments survive being encoded, as in a watcher's events.
+	data, _ := json.Marshal(tx)
+	var decoded Transaction
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Attachments) != 1 || decoded.Attachments[0].ID != att.ID {
+		t.Errorf("expected the attachment to round trip through JSON, got %+v, %v", decoded.Attachments, err)
+	}
+
+	if err := tx.Attachments[0].Remove(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stored := srv.Attachments(tx.ID); len(stored) != 0 {
+		t.Fatalf("expected the attachment to be removed, got %+v", stored)
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	srv, c, acc := newTestAccount(t, monzotest.Account{})
+	defer srv.Close()
+
+	seededTx, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -1200})
+
+	tx, _ := acc.Transaction(seededTx.ID)
+
+	coffee := MakeReceiptItem("Coffee", 300, CurrencyGBP)
+	coffee.AddSubItem(MakeReceiptItem("Oat milk", 50, CurrencyGBP))
+
+	r := MakeReceipt("order-1")
+	r.AddItem(coffee, MakeReceiptItem("Sandwich", 900, CurrencyGBP))
+	r.AddTax(Tax{Description: "VAT", Amount: 200, Currency: CurrencyGBP, TaxNumber: "GB123"})
+	r.AddPayment(Payment{Type: PaymentCard, Amount: 1200, Currency: CurrencyGBP, LastFour: "4242", AuthCode: "123456"})
+	r.SetMerchant(ReceiptMerchant{Name: "Cafe", StorePostcode: "N1 1AA"})
+
+	if err := tx.AddReceipt(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := c.Receipt("order-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.ID == "" || got.TransactionID != tx.ID || got.Total != 1200 || len(got.Items) != 2 {
+		t.Fatalf("unexpected receipt %+v", got)
+	}
+
+	if len(got.Items[0].subItems) != 1 || got.Items[0].subItems[0].description != "Oat milk" {
+		t.Errorf("expected the sub item to round trip, got %+v", got.Items[0])
+	}
+
+	if got.Taxes[0].TaxNumber != "GB123" || got.Payments[0].LastFour != "4242" || got.Merchant.StorePostcode != "N1 1AA" {
+		t.Errorf("unexpected receipt sections %+v %+v %+v", got.Taxes, got.Payments, got.Merchant)
+	}
+
+	if err := c.DeleteReceipt("order-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Receipt("order-1"); !IsNotFound(err) {
+		t.Fatalf("expected the receipt to be deleted, got %v", err)
+	}
+}
+
+func TestReceiptValidate(t *testing.T) {
+	nested := MakeReceiptItem("Meal deal", 500, CurrencyGBP)
+	sub := MakeReceiptItem("Drink", 100, CurrencyGBP)
+	sub.AddSubItem(MakeReceiptItem("Ice", 0, CurrencyGBP))
+	nested.AddSubItem(sub)
+
+	zero := MakeReceiptItem("Free sample", 0, CurrencyUSD)
+	zero.Quantity(0)
+
+	r := MakeReceipt("")
+	r.AddItem(nested, zero)
+
+	err := r.Validate()
+
+	var errs ReceiptErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ReceiptErrors, got %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+
+	for _, f := range []string{"external_id", "items[0].sub_items[0].sub_items", "items[1].quantity", "items[1].currency"} {
+		if !fields[f] {
+			t.Errorf("expected a problem with %s, got %v", f, err)
+		}
+	}
+
+	srv, _, acc := newTestAccount(t, monzotest.Account{})
+	defer srv.Close()
+
+	seededTx, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -1000})
+
+	tx, _ := acc.Transaction(seededTx.ID)
+
+	r = MakeReceipt("order-1")
+	r.AddItem(MakeReceiptItem("Book", 999, CurrencyGBP))
+
+	if err := tx.AddReceipt(r); !errors.As(err, &errs) || errs[0].Field != "total" {
+		t.Fatalf("expected the total to be rejected, got %v", err)
+	}
+
+	if _, ok := srv.Receipt("order-1"); ok {
+		t.Fatal("expected the invalid receipt not to be sent")
+	}
+
+	if r.TransactionID != "" || r.expected != nil {
+		t.Errorf("expected the receipt to be left unchanged, got %+v", r)
+	}
+
+	// A check left over from an earlier transaction mustn't apply
+	// to one with no amount.
+	r.expectTransaction(tx)
+	r.expectTransaction(Transaction{})
+	if r.expected != nil {
+		t.Errorf("expected the earlier transaction's total to be cleared, got %v", r.expected)
+	}
+}
+
+func TestReceiptRoundTrip(t *testing.T) {
+	coffee := MakeReceiptItem("Coffee", 300, CurrencyGBP)
+	coffee.Quantity(2)
+	coffee.Unit("cup")
+	coffee.AddSubItem(MakeReceiptItem("Oat milk", 50, CurrencyGBP))
+
+	r := MakeReceipt("order-1")
+	r.ID = "receipt_1"
+	r.SetTransaction("tx_1")
+	r.AddItem(coffee)
+	r.AddTax(Tax{Description: "VAT", Amount: 50, Currency: CurrencyGBP})
+
+	first, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if r.Total != 0 || r.Currency != "" {
+		t.Errorf("expected marshalling not to change the receipt, got total %d and currency %q", r.Total, r.Currency)
+	}
+
+	var loaded Receipt
+	if err := json.Unmarshal(first, &loaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if loaded.ID != "receipt_1" {
+		t.Errorf("expected the receipt ID to round trip, got %q", loaded.ID)
+	}
+
+	item := loaded.Items[0]
+	if item.Description() != "Coffee" || item.Amount() != 300 || item.QuantityValue() != 2 || item.UnitValue() != "cup" {
+		t.Errorf("unexpected item after round trip: %+v", item)
+	}
+
+	if len(item.SubItems()) != 1 || item.SubItems()[0].Description() != "Oat milk" {
+		t.Errorf("unexpected sub items after round trip: %+v", item.SubItems())
+	}
+
+	second, err := json.Marshal(&loaded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(first) != string(second) {
+		t.Errorf("expected the receipt to round trip\n%s\n%s", first, second)
+	}
+
+	// Receipts held by value, such as in a caller's own struct,
+	// must use the same format.
+	type saved struct {
+		Receipt Receipt `json:"receipt"`
+		Item    Item    `json:"item"`
+	}
+
+	held, err := json.Marshal(saved{Receipt: loaded, Item: *item})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(held), string(first)) {
+		t.Errorf("expected a receipt held by value to marshal like a pointer\n%s\n%s", held, first)
+	}
+
+	var back saved
+	if err := json.Unmarshal(held, &back); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if back.Receipt.ID != "receipt_1" || len(back.Receipt.Items) != 1 || back.Item.Description() != "Coffee" {
+		t.Errorf("unexpected receipt after round trip by value: %+v", back)
+	}
+
+	var apples Item
+	if err := json.Unmarshal([]byte(`{"description": "Apples", "quantity": 0.5, "unit": "kg", "amount": 100, "currency": "GBP"}`), &apples); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if apples.QuantityValue() != 0.5 || apples.UnitValue() != "kg" {
+		t.Errorf("expected 0.5 kg of apples, got %v %s", apples.QuantityValue(), apples.UnitValue())
+	}
+
+	data, err := json.Marshal(&apples)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"quantity":0.5`) {
+		t.Errorf("expected the fractional quantity to be sent, got %s", data)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	created := make(chan Transaction, 1)
+	other := make(chan Event, 1)
+	release := make(chan struct{})
+
+	h := NewWebhookHandler(WithWebhookSecret("s3cret"), WithWebhookWorkers(1, 0))
+	h.HandleTransactionCreated(func(ctx context.Context, tx Transaction) error {
+		created <- tx
+		<-release
+		return nil
+	})
+	h.HandleDefault(func(ctx context.Context, e Event) error {
+		other <- e
+		return nil
+	})
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	endpoint, _ := WebhookURL(srv.URL+"/hook", "s3cret")
+
+	post := func(endpoint, body string) int {
+		resp, err := http.Post(endpoint, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tx := `{"type": "transaction.created", "data": {"id": "tx_1", "amount": -350, "currency": "GBP", "settled": ""}}`
+
+	if code := post(srv.URL+"/hook?secret=wrong", tx); code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong secret to be rejected, got %d", code)
+	}
+
+	if code := post(endpoint, `{"data": {}}`); code != http.StatusBadRequest {
+		t.Errorf("expected an event without a type to be rejected, got %d", code)
+	}
+
+	if code := post(endpoint, tx); code != http.StatusOK {
+		t.Fatalf("expected the event to be accepted, got %d", code)
+	}
+
+	got := <-created
+	if got.ID != "tx_1" || got.Money() != NewMoney(-350, CurrencyGBP) {
+		t.Errorf("unexpected transaction %+v", got)
+	}
+
+	// The only worker is busy and there is no queue.
+	if code := post(endpoint, tx); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a full pool to reply 503, got %d", code)
+	}
+
+	close(release)
+
+	for {
+		if code := post(endpoint, `{"type": "account.updated", "data": {}}`); code == http.StatusOK {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if e := <-other; e.Type != "account.updated" || e.Received.IsZero() {
+		t.Errorf("expected the unknown event to reach the fallback, got %+v", e)
+	}
+
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if code := post(endpoint, tx); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a closed handler to reply 503, got %d", code)
+	}
+}
+
+func TestSyncWebhooks(t *testing.T) {
+	srv, _, acc := newTestAccount(t, monzotest.Account{})
+	defer srv.Close()
+
+	stale, err := acc.RegisterWebhook("https://old.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stale.ID == "" || stale.URL != "https://old.example.com" {
+		t.Fatalf("expected the created webhook to be returned, got %+v", stale)
+	}
+
+	acc.RegisterWebhook("https://a.example.com")
+	acc.RegisterWebhook("https://a.example.com")
+
+	want := []string{"https://a.example.com", "https://b.example.com"}
+
+	plan, err := acc.PlanWebhooks(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(plan.Add) != 1 || len(plan.Remove) != 2 || len(plan.Keep) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	if len(srv.Webhooks(acc.ID)) != 3 {
+		t.Fatal("expected planning to make no changes")
+	}
+
+	// Deleting one of the webhooks out from under the plan
+	// shouldn't stop it applying.
+	if err := stale.Delete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(plan.Add) != 1 || len(plan.Remove) != 2 || len(plan.Keep) != 1 {
+		t.Errorf("expected applying to leave the plan as it was, got %+v", plan)
+	}
+
+	if added := plan.Registered(); len(added) != 1 || added[0].URL != want[1] || added[0].ID == "" {
+		t.Errorf("unexpected registered webhooks %+v", added)
+	}
+
+	// Applying again has nothing left to do.
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hooks, _ := acc.Webhooks()
+	if len(hooks) != 2 || hooks[0].URL != want[0] || hooks[1].URL != want[1] {
+		t.Fatalf("unexpected webhooks after sync %+v", hooks)
+	}
+
+	plan, err = acc.SyncWebhooks(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !plan.Empty() || len(plan.Keep) != 2 {
+		t.Errorf("expected syncing again to change nothing, got %+v", plan)
+	}
+}
+
+func TestEventStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	event := func(eventType, id string, received time.Time) Event {
+		var e Event
+		data := fmt.Sprintf(`{"type": %q, "data": {"id": %q, "amount": -100, "currency": "GBP"}}`, eventType, id)
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+		e.Received = received
+		return e
+	}
+
+	for _, store := range []EventStore{NewMemoryEventStore(), NewFileEventStore(path)} {
+		for i, e := range []Event{
+			event(EventTransactionCreated, "tx_1", start),
+			event(EventTransactionCreated, "tx_2", start.Add(time.Hour)),
+			event("transaction.updated", "tx_1", start.Add(2*time.Hour)),
+		} {
+			if fresh, err := store.Append(ctx, e); err != nil || !fresh {
+				t.Fatalf("expected event %d to be recorded, got %v, %v", i, fresh, err)
+			}
+		}
+
+		if fresh, _ := store.Append(ctx, event(EventTransactionCreated, "tx_1", start.Add(3*time.Hour))); fresh {
+			t.Errorf("%T: expected a redelivered event to be dropped", store)
+		}
+
+		if queued, err := store.Queued(ctx, event(EventTransactionCreated, "tx_1", start)); err != nil || queued {
+			t.Errorf("%T: expected the event not to be queued yet, got %v, %v", store, queued, err)
+		}
+
+		if err := store.MarkQueued(ctx, event(EventTransactionCreated, "tx_1", start)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if queued, err := store.Queued(ctx, event(EventTransactionCreated, "tx_1", start)); err != nil || !queued {
+			t.Errorf("%T: expected the event to be queued, got %v, %v", store, queued, err)
+		}
+
+		var ids []string
+		err := store.Replay(ctx, start.Add(time.Hour), func(ctx context.Context, e Event) error {
+			ids = append(ids, e.Type+":"+e.Transaction.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if strings.Join(ids, ",") != "transaction.created:tx_2,transaction.updated:tx_1" {
+			t.Errorf("%T: unexpected replay %v", store, ids)
+		}
+	}
+
+	updated := event("transaction.updated", "tx_1", start)
+	updated.Data = json.RawMessage(`{"id": "tx_1", "amount": -100, "currency": "GBP", "notes": "lunch"}`)
+	if updated.DedupeKey() == event("transaction.updated", "tx_1", start).DedupeKey() {
+		t.Error("expected different updates to the same transaction to have different keys")
+	}
+
+	// Simulate a crash part way through writing an event.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"type": "transaction.cre`)
+	f.Close()
+
+	// A new store, as if from another process, must still know
+	// which events have been recorded.
+	reopened := NewFileEventStore(path)
+	if fresh, _ := reopened.Append(ctx, event(EventTransactionCreated, "tx_2", start)); fresh {
+		t.Error("expected an event recorded by another store to be dropped")
+	}
+
+	if fresh, err := reopened.Append(ctx, event(EventTransactionCreated, "tx_3", start)); err != nil || !fresh {
+		t.Fatalf("expected a new event to be recorded, got %v, %v", fresh, err)
+	}
+
+	if queued, _ := reopened.Queued(ctx, event(EventTransactionCreated, "tx_1", start)); !queued {
+		t.Error("expected an event queued by another store to be known")
+	}
+
+	count := 0
+	reopened.Replay(ctx, time.Time{}, func(ctx context.Context, e Event) error {
+		count++
+		return nil
+	})
+
+	if count != 4 {
+		t.Errorf("expected the torn line to be skipped, got %d events", count)
+	}
+}
+
+func TestWebhookHandlerEventStore(t *testing.T) {
+	store := NewMemoryEventStore()
+	handled := make(chan string, 10)
+
+	h := NewWebhookHandler(WithEventStore(store))
+	h.HandleTransactionCreated(func(ctx context.Context, tx Transaction) error {
+		handled <- tx.ID
+		return nil
+	})
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"type": "transaction.created", "data": {"id": "tx_1"}}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the event to be acknowledged, got %d", resp.StatusCode)
+		}
+	}
+
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(handled) != 1 {
+		t.Errorf("expected the event to be handled once, got %d", len(handled))
+	}
+
+	replayed := 0
+	store.Replay(context.Background(), time.Time{}, func(ctx context.Context, e Event) error {
+		replayed++
+		return nil
+	})
+
+	if replayed != 1 {
+		t.Errorf("expected one event to be stored, got %d", replayed)
+	}
+}
+
+func TestWebhookHandlerRedelivery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+
+	post := func(h http.Handler, id string) int {
+		body := fmt.Sprintf(`{"type": "transaction.created", "data": {"id": %q}}`, id)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	busy := NewWebhookHandler(WithEventStore(NewFileEventStore(path)), WithWebhookWorkers(1, 0))
+	busy.HandleTransactionCreated(func(ctx context.Context, tx Transaction) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	// The worker may not be waiting for work yet.
+	for post(busy, "tx_0") != http.StatusOK {
+		time.Sleep(10 * time.Millisecond)
+	}
+	<-started
+
+	if code := post(busy, "tx_1"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a full pool to reply 503, got %d", code)
+	}
+
+	close(release)
+	busy.Close(context.Background())
+
+	// Monzo's retry reaches another handler sharing the store,
+	// as if after a restart.
+	handled := make(chan string, 10)
+	h := NewWebhookHandler(WithEventStore(NewFileEventStore(path)))
+	h.HandleTransactionCreated(func(ctx context.Context, tx Transaction) error {
+		handled <- tx.ID
+		return nil
+	})
+
+	for _, id := range []string{"tx_0", "tx_1", "tx_1"} {
+		if code := post(h, id); code != http.StatusOK {
+			t.Fatalf("expected %s to be acknowledged, got %d", id, code)
+		}
+	}
+
+	h.Close(context.Background())
+	close(handled)
+
+	var ids []string
+	for id := range handled {
+		ids = append(ids, id)
+	}
+
+	if strings.Join(ids, ",") != "tx_1" {
+		t.Errorf("expected only the event that was never queued to be handled, got %v", ids)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv, _, acc := newTestAccount(t, monzotest.Account{Currency: "GBP"})
+	defer srv.Close()
+
+	srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -100, Created: time.Now().Add(-time.Hour)})
+
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileWatchStore(filepath.Join(dir, "watch.json"))
+
+	watch := func() (<-chan Event, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		events := acc.Watch(ctx, 10*time.Millisecond, WithWatchStore(store), WithWatchErrorHandler(func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		}))
+		return events, cancel
+	}
+
+	expect := func(events <-chan Event, eventType, id string, changes ...string) {
+		t.Helper()
+
+		select {
+		case e := <-events:
+			if e.Type != eventType || e.Transaction.ID != id {
+				t.Fatalf("expected %s for %s, got %s for %s", eventType, id, e.Type, e.Transaction.ID)
+			}
+			if strings.Join(e.Changes, ",") != strings.Join(changes, ",") {
+				t.Fatalf("expected %s for %s to change %v, got %v", eventType, id, changes, e.Changes)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s for %s", eventType, id)
+		}
+	}
+
+	events, cancel := watch()
+	defer func() { cancel() }()
+
+	// Wait for the first poll to record what's already there.
+	for {
+		if _, err := store.Load(context.Background()); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	pending, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -500, AmountIsPending: true})
+	expect(events, EventTransactionCreated, pending.ID)
+
+	srv.ChangeTransactionAmount(pending.ID, -550)
+	expect(events, EventTransactionUpdated, pending.ID, "amount")
+
+	srv.SettleTransaction(pending.ID, time.Now())
+	expect(events, EventTransactionUpdated, pending.ID, "settled")
+
+	tx, _ := acc.Transaction(pending.ID)
+	if err := tx.Note("lunch"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect(events, EventTransactionUpdated, pending.ID, "notes")
+
+	declined, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -9999, DeclineReason: "INSUFFICIENT_FUNDS"})
+	expect(events, EventTransactionCreated, declined.ID)
+
+	// Events are sent before the state is saved, so wait for
+	// the save before stopping.
+	for {
+		if state, err := store.Load(context.Background()); err == nil {
+			if _, ok := state.Transactions[declined.ID]; ok {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	for range events {
+	}
+
+	// A new watcher picks up from the stored state, so nothing
+	// is sent again.
+	later, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -200})
+
+	events, cancel = watch()
+
+	expect(events, EventTransactionCreated, later.ID)
+
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %s for %s", e.Type, e.Transaction.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchBoundaries(t *testing.T) {
+	srv, _, acc := newTestAccount(t, monzotest.Account{Currency: "GBP"})
+	defer srv.Close()
+
+	// Monzo only takes since to the second, so settled
+	// transactions in the same second as since, or as the prune
+	// cutoff, come back.
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -100, Created: base.Add(100 * time.Millisecond), Settled: base.Add(time.Minute)})
+	a, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -200, Created: base.Add(500 * time.Millisecond), Settled: base.Add(time.Minute)})
+	b, _ := srv.AddTransaction(monzotest.Transaction{AccountID: acc.ID, Amount: -300, Created: base.Add(1900 * time.Millisecond), Settled: base.Add(time.Minute)})
+
+	poll := func(w *watcher) []string {
+		t.Helper()
+
+		events := make(chan Event, 10)
+		if err := w.poll(context.Background(), events); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		close(events)
+
+		var ids []string
+		for e := range events {
+			ids = append(ids, e.Type+" "+e.Transaction.ID)
+		}
+		return ids
+	}
+
+	w := &watcher{acc: acc, store: &MemoryWatchStore{}, since: base.Add(200 * time.Millisecond), lookback: time.Second, now: time.Now}
+
+	want := []string{EventTransactionCreated + " " + a.ID, EventTransactionCreated + " " + b.ID}
+	if got := poll(w); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v on the first poll, got %v", want, got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := poll(w); len(got) != 0 {
+			t.Fatalf("expected nothing to be sent again, got %v", got)
+		}
+	}
+
+	// Nothing is created after since, so the next poll looks back
+	// over the transactions from before it.
+	w = &watcher{acc: acc, store: &MemoryWatchStore{}, since: base.Add(time.Minute), lookback: time.Hour, now: time.Now}
+	for i := 0; i < 2; i++ {
+		if got := poll(w); len(got) != 0 {
+			t.Fatalf("expected nothing from before since, got %v", got)
+		}
+	}
+}
+
+func TestDedupeIDs(t *testing.T) {
+	srv, c, acc := newTestAccount(t, monzotest.Account{Currency: "GBP", Balance: 10000})
+	defer srv.Close()
+
+	pot := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP"})
+
+	p, _ := c.Pot(pot.ID)
+
+	d1, _ := acc.Deposit(p, 100)
+	d2, _ := acc.Deposit(p, 100)
+	if len(d1.DedupeID) != 32 || d1.DedupeID == d2.DedupeID {
+		t.Errorf("expected distinct random dedupe IDs, got %q and %q", d1.DedupeID, d2.DedupeID)
+	}
+
+	if d, _ := acc.Deposit(p, 100, WithDedupeID("mine")); d.DedupeID != "mine" {
+		t.Errorf("expected the given dedupe ID, got %q", d.DedupeID)
+	}
+
+	i1, _ := acc.Deposit(p, 100, WithIntent("rent"))
+	i2, _ := acc.Deposit(p, 100, WithIntent("rent"))
+	i3, _ := acc.Deposit(p, 200, WithIntent("rent"))
+	w1, _ := acc.Withdraw(p, 100, WithIntent("rent"))
+	if i1.DedupeID != i2.DedupeID || i1.DedupeID == i3.DedupeID || i1.DedupeID == w1.DedupeID {
+		t.Errorf("unexpected intent dedupe IDs %q %q %q %q", i1.DedupeID, i2.DedupeID, i3.DedupeID, w1.DedupeID)
+	}
+
+	if _, err := i1.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := i2.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, _ := srv.Pot(pot.ID); got.Balance != 100 {
+		t.Errorf("expected the deposit to be made once, got a balance of %d", got.Balance)
+	}
+
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dedupe.json")
+
+	c = NewClient("token", WithBaseURL(srv.URL), WithDedupeStore(NewFileDedupeStore(path)))
+	if acc, err = c.Account(acc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, _ := acc.Deposit(p, 100, WithIntent("savings"))
+
+	// A restarted job reuses the dedupe ID it saved.
+	c = NewClient("token", WithBaseURL(srv.URL), WithDedupeStore(NewFileDedupeStore(path)))
+	if acc, err = c.Account(acc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := acc.Deposit(p, 100, WithIntent("savings"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if again.DedupeID != first.DedupeID {
+		t.Errorf("expected the saved dedupe ID %q, got %q", first.DedupeID, again.DedupeID)
+	}
+
+	// One that works out a different amount is stopped.
+	if _, err := acc.Deposit(p, 150, WithIntent("savings")); !errors.Is(err, ErrIntentAmount) {
+		t.Errorf("expected ErrIntentAmount, got %v", err)
+	}
+
+	if _, err := acc.Deposit(p, 100, WithIntent("savings"), WithDedupeID("mine")); err == nil {
+		t.Error("expected an error combining WithIntent and WithDedupeID")
+	}
+
+	// The context reaches the DedupeStore.
+	c = NewClient("token", WithBaseURL(srv.URL), WithDedupeStore(ctxDedupeStore{NewMemoryDedupeStore()}))
+	if acc, err = c.Account(acc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := acc.DepositContext(ctx, p, 100, WithIntent("savings")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := acc.WithdrawContext(ctx, p, 100, WithIntent("savings")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// ctxDedupeStore fails loads once the context is done, like a
+// store backed by a remote service would.
+type ctxDedupeStore struct {
+	*MemoryDedupeStore
+}
+
+func (s ctxDedupeStore) Load(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return s.MemoryDedupeStore.Load(ctx, key)
+}
+
+func TestPotResult(t *testing.T) {
+	srv, c, acc := newTestAccount(t, monzotest.Account{Currency: "GBP", Balance: 10000}, WithDedupeStore(NewMemoryDedupeStore()))
+	defer srv.Close()
+
+	pot := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP"})
+
+	p, _ := c.Pot(pot.ID)
+
+	d, _ := acc.Deposit(p, 2500)
+
+	res, err := d.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Pot.ID != pot.ID || res.Pot.Balance != 2500 || res.DedupeID != d.DedupeID || res.Replayed {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	// Running again sends the same request, which Monzo dedupes.
+	res, err = d.Run()
+	if err != nil {
+		t.Fatalf("unexpected error running again: %v", err)
+	}
+
+	if !res.Replayed || res.Pot.Balance != 2500 {
+		t.Errorf("expected a replay, got %+v", res)
+	}
+
+	if got, _ := srv.Pot(pot.ID); got.Balance != 2500 {
+		t.Errorf("expected the deposit to be made once, got a balance of %d", got.Balance)
+	}
+
+	wd, _ := acc.Withdraw(p, 1000)
+	if res, err := wd.Run(); err != nil || res.Pot.Money() != NewMoney(1500, CurrencyGBP) || res.Replayed {
+		t.Errorf("unexpected withdrawal result %+v, %v", res, err)
+	}
+
+	// Without a DedupeStore, runs aren't tracked.
+	plain := NewClient("token", WithBaseURL(srv.URL))
+	pacc, err := plain.Account(acc.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pd, _ := pacc.Deposit(p, 100)
+	pd.Run()
+	if res, err := pd.Run(); err != nil || res.Replayed {
+		t.Errorf("expected no replay to be reported without a store, got %+v, %v", res, err)
+	}
+
+	big, _ := acc.Deposit(p, 1000000)
+	if _, err := big.Run(); err == nil || !strings.HasPrefix(err.Error(), "failed to deposit") {
+		t.Errorf("expected a deposit error, got %v", err)
+	}
+}
+
+// lostResponses sends requests for a path on, then fails them as
+// if the response had been lost on the way back.
+type lostResponses struct {
+	mu   sync.Mutex
+	path string
+	n    int
+}
+
+func (l *lostResponses) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err == nil && req.URL.Path == l.path && l.n > 0 {
+		l.n--
+		resp.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+
+	return resp, err
+}
+
+func TestTransferBetweenPots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileTransferStore(filepath.Join(dir, "transfers.json"))
+	lost := &lostResponses{}
+
+	srv, c, acc := newTestAccount(t, monzotest.Account{Currency: "GBP", Balance: 1000},
+		WithTransport(lost),
+		WithTransferStore(store),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+	defer srv.Close()
+
+	src := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP", Balance: 5000})
+	dst := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP"})
+	gone := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP", Deleted: true})
+
+	balances := func() (int64, int64, int64) {
+		a, _ := srv.Account(acc.ID)
+		s, _ := srv.Pot(src.ID)
+		d, _ := srv.Pot(dst.ID)
+		return a.Balance, s.Balance, d.Balance
+	}
+
+	lost.path, lost.n = "/pots/"+dst.ID+"/deposit", 2
+
+	from := Pot{ID: src.ID, Currency: CurrencyGBP}
+	to := Pot{ID: dst.ID, Currency: CurrencyGBP}
+
+	tr, err := c.TransferBetweenPots(from, to, 2000, acc)
+	if err != nil || tr.Status != TransferCompleted {
+		t.Fatalf("expected the transfer to complete, got %+v, %v", tr, err)
+	}
+
+	if a, s, d := balances(); a != 1000 || s != 3000 || d != 2000 {
+		t.Fatalf("unexpected balances %d %d %d", a, s, d)
+	}
+
+	// The deposit's response is lost on every attempt, so the
+	// transfer is left unfinished.
+	lost.n = 2
+	tr, err = c.TransferBetweenPots(from, to, 500, acc, WithTransferID("t-1"), WithTransferAttempts(2))
+	if err == nil || tr.Status != TransferWithdrawn {
+		t.Fatalf("expected the transfer to be unfinished, got %+v, %v", tr, err)
+	}
+
+	// Resuming, as if after a restart, must not deposit twice
+	// even though the lost deposits reached Monzo.
+	c = NewClient("token", WithBaseURL(srv.URL), WithTransferStore(store))
+	tr, err = c.ResumeTransfer("t-1")
+	if err != nil || tr.Status != TransferCompleted {
+		t.Fatalf("expected the resumed transfer to complete, got %+v, %v", tr, err)
+	}
+
+	if a, s, d := balances(); a != 1000 || s != 2500 || d != 2500 {
+		t.Fatalf("unexpected balances after resuming %d %d %d", a, s, d)
+	}
+
+	// A deposit Monzo rejects is rolled back.
+	tr, err = c.TransferBetweenPots(from, Pot{ID: gone.ID}, 700, acc)
+	if err == nil || tr.Status != TransferRolledBack || tr.Reason != "not_found.pot: Pot not found" {
+		t.Fatalf("expected the transfer to roll back, got %+v, %v", tr, err)
+	}
+
+	if a, s, _ := balances(); a != 1000 || s != 2500 {
+		t.Fatalf("unexpected balances after rolling back %d %d", a, s)
+	}
+
+	// A withdrawal Monzo rejects moves nothing.
+	tr, err = c.TransferBetweenPots(from, to, 1000000, acc)
+	if err == nil || tr.Status != TransferFailed {
+		t.Fatalf("expected the transfer to fail, got %+v, %v", tr, err)
+	}
+
+	list, _ := store.List(context.Background())
+	if len(list) != 4 || list[1].ID != "t-1" {
+		t.Errorf("unexpected stored transfers %+v", list)
+	}
+}
+
+// failedResponses answers requests for the paths in status with
+// that status, without sending them on, and counts them.
+type failedResponses struct {
+	mu     sync.Mutex
+	status map[string]int
+	sent   map[string]int
+}
+
+func (f *failedResponses) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	code, ok := f.status[req.URL.Path]
+	if !ok {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	f.sent[req.URL.Path]++
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"code": "failed", "message": "failed"}`)),
+		Request:    req,
+	}, nil
+}
+
+func (f *failedResponses) fail(path string, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if code == 0 {
+		delete(f.status, path)
+		return
+	}
+
+	f.status[path] = code
+}
+
+func TestTransferFailures(t *testing.T) {
+	failed := &failedResponses{status: make(map[string]int), sent: make(map[string]int)}
+
+	// The Client would retry a 503 itself, but the transfer's
+	// own attempts replace its retries.
+	srv, c, acc := newTestAccount(t, monzotest.Account{Currency: "GBP", Balance: 1000},
+		WithTransport(failed),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}),
+	)
+	defer srv.Close()
+
+	src := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP", Balance: 5000})
+	dst := srv.AddPot(monzotest.Pot{AccountID: acc.ID, Currency: "GBP"})
+
+	deposit := "/pots/" + dst.ID + "/deposit"
+	rollback := "/pots/" + src.ID + "/deposit"
+	failed.fail(deposit, http.StatusServiceUnavailable)
+
+	from := Pot{ID: src.ID, Currency: CurrencyGBP}
+	to := Pot{ID: dst.ID, Currency: CurrencyGBP}
+
+	tr, err := c.TransferBetweenPots(from, to, 100, acc, WithTransferAttempts(2))
+	if err == nil || tr.Status != TransferWithdrawn {
+		t.Fatalf("expected the transfer to be unfinished, got %+v, %v", tr, err)
+	}
+
+	if failed.sent[deposit] != 2 {
+		t.Errorf("expected the deposit to be sent twice, got %d", failed.sent[deposit])
+	}
+
+	// Refused credentials may be fixed, so the transfer is left
+	// to be resumed rather than rolled back.
+	failed.fail(deposit, http.StatusForbidden)
+	tr, err = c.ResumeTransfer(tr.ID, WithTransferAttempts(1))
+	if err == nil || tr.Status != TransferWithdrawn {
+		t.Fatalf("expected the transfer to be unfinished after a 403, got %+v, %v", tr, err)
+	}
+
+	// If the deposit and the rollback are both rejected, the
+	// money is stranded until the transfer is resumed.
+	failed.fail(deposit, http.StatusConflict)
+	failed.fail(rollback, http.StatusConflict)
+
+	tr, err = c.ResumeTransfer(tr.ID)
+	if err == nil || tr.Status != TransferStranded || tr.Status.Final() {
+		t.Fatalf("expected the transfer to be stranded, got %+v, %v", tr, err)
+	}
+
+	failed.fail(rollback, 0)
+	tr, err = c.ResumeTransfer(tr.ID)
+	if tr.Status != TransferRolledBack {
+		t.Fatalf("expected the stranded transfer to roll back, got %+v, %v", tr, err)
+	}
+
+	if p, _ := srv.Pot(src.ID); p.Balance != 5000 {
+		t.Errorf("expected the money to be back in the source pot, got %d", p.Balance)
+	}
+}
+
+func TestHandBuiltDeposit(t *testing.T) {
+	srv := monzotest.NewServer("token")
+	defer srv.Close()
+
+	seeded := srv.AddAccount(monzotest.Account{Currency: "GBP", Balance: 1000})
+	pot := srv.AddPot(monzotest.Pot{AccountID: seeded.ID, Currency: "GBP"})
+
+	form := "source_account_id=" + seeded.ID + "&amount=300&dedupe_id=by-hand"
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/pots/"+pot.ID+"/deposit", strings.NewReader(form))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	d := Deposit{Request: req, Client: http.DefaultClient}
+	res, err := d.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Pot.Balance != 300 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Second}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", "7200")
+
+	if wait := p.backoff(2, resp); wait != time.Second {
+		t.Errorf("expected Retry-After to be capped at MaxBackoff, got %v", wait)
+	}
+
+	resp.Header.Set("Retry-After", "0")
+	if wait := p.backoff(2, resp); wait != 0 {
+		t.Errorf("expected a Retry-After of 0 to be honoured, got %v", wait)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "store")
+
+	// A lock file left behind by a holder that crashed doesn't
+	// stop the lock being taken, where the OS holds the locks.
+	if osLocks {
+		ioutil.WriteFile(path+".lock", []byte("12345"), 0600)
+	}
+
+	first, cancelFirst := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFirst()
+
+	unlock, err := lockFile(first, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A holder that is still running is waited for, however long
+	// it takes.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := lockFile(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for the holder, got %v", err)
+	}
+
+	unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	held := 0
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := lockFile(context.Background(), path)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			mu.Lock()
+			held++
+			if held > 1 {
+				t.Error("expected the lock to have one holder at a time")
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			held--
+			mu.Unlock()
+
+			unlock()
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,155 @@
+package monzotest
+
+import "time"
+
+// The functions in this file render resources the way the Monzo
+// API does, including its field names and timestamp format.
+
+func accountJSON(a *Account) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             a.ID,
+		"description":    a.Description,
+		"type":           a.Type,
+		"currency":       a.Currency,
+		"country_code":   a.CountryCode,
+		"account_number": a.AccountNumber,
+		"sort_code":      a.SortCode,
+		"closed":         a.Closed,
+		"created":        timeJSON(a.Created),
+	}
+}
+
+func potJSON(p *Pot) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 p.ID,
+		"name":               p.Name,
+		"balance":            p.Balance,
+		"currency":           p.Currency,
+		"current_account_id": p.AccountID,
+		"deleted":            p.Deleted,
+		"created":            timeJSON(p.Created),
+		"updated":            timeJSON(p.Updated),
+	}
+}
+
+// transactionJSON renders t, with its merchant in full if expand
+// is set. It must be called with s.mu held.
+func (s *Server) transactionJSON(t *Transaction, expand bool) map[string]interface{} {
+	var merchant interface{}
+	if t.Merchant != nil {
+		merchant = t.Merchant.ID
+		if expand {
+			merchant = merchantJSON(t.Merchant)
+		}
+	}
+
+	counterparty := map[string]interface{}{}
+	if c := t.Counterparty; c != nil {
+		counterparty = map[string]interface{}{
+			"name":           c.Name,
+			"account_number": c.AccountNumber,
+			"sort_code":      c.SortCode,
+			"user_id":        c.UserID,
+			"account_id":     c.AccountID,
+		}
+	}
+
+	categories := map[string]int64{}
+	if t.Category != "" {
+		categories[t.Category] = t.Amount
+	}
+
+	attachments := []interface{}{}
+	for _, a := range s.attachments {
+		if a.TransactionID == t.ID {
+			attachments = append(attachments, attachmentJSON(a))
+		}
+	}
+
+	labels := t.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+
+	return map[string]interface{}{
+		"id":              t.ID,
+		"account_id":      t.AccountID,
+		"amount":          t.Amount,
+		"currency":        t.Currency,
+		"description":     t.Description,
+		"notes":           t.Notes,
+		"category":        t.Category,
+		"scheme":          t.Scheme,
+		"dedupe_id":       t.DedupeID,
+		"decline_reason":  t.DeclineReason,
+		"is_load":         t.IsLoad,
+		"metadata":        t.Metadata,
+		"account_balance": t.AccountBalance,
+		"created":         timeJSON(t.Created),
+		"settled":         timeJSON(t.Settled),
+		"merchant":        merchant,
+		"counterparty":    counterparty,
+		"labels":          labels,
+		"attachments":     attachments,
+		"originator":      t.Amount < 0,
+		"local_amount":    t.LocalAmount,
+		"local_currency":  t.LocalCurrency,
+		"categories":      categories,
+
+		"amount_is_pending":              t.AmountIsPending,
+		"include_in_spending":            t.Scheme != "uk_retail_pot" && t.DeclineReason == "",
+		"can_be_excluded_from_breakdown": t.Scheme != "uk_retail_pot",
+	}
+}
+
+func merchantJSON(m *Merchant) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       m.ID,
+		"group_id": m.GroupID,
+		"name":     m.Name,
+		"logo":     m.Logo,
+		"emoji":    m.Emoji,
+		"category": m.Category,
+		"online":   m.Online,
+		"atm":      m.ATM,
+		"metadata": m.Metadata,
+		"address": map[string]interface{}{
+			"address":   m.Address.Address,
+			"city":      m.Address.City,
+			"region":    m.Address.Region,
+			"country":   m.Address.Country,
+			"postcode":  m.Address.Postcode,
+			"latitude":  m.Address.Latitude,
+			"longitude": m.Address.Longitude,
+		},
+	}
+}
+
+func attachmentJSON(a *Attachment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          a.ID,
+		"external_id": a.TransactionID,
+		"file_url":    a.FileURL,
+		"file_type":   a.FileType,
+		"created":     timeJSON(a.Created),
+	}
+}
+
+func webhookJSON(h *Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         h.ID,
+		"account_id": h.AccountID,
+		"url":        h.URL,
+	}
+}
+
+// timeJSON formats t like Monzo does. Monzo sends an empty
+// string for times that haven't happened yet, such as the
+// settlement of a pending transaction.
+func timeJSON(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
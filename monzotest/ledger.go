@@ -0,0 +1,462 @@
+package monzotest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Account is an account held by the fake server.
+type Account struct {
+	ID            string
+	Description   string
+	Type          string
+	Currency      string
+	CountryCode   string
+	AccountNumber string
+	SortCode      string
+	Closed        bool
+	Created       time.Time
+
+	// Balance is in minor units. It changes as transactions are
+	// added and money moves in and out of pots.
+	Balance int64
+}
+
+// Pot is a pot held by the fake server.
+type Pot struct {
+	ID        string
+	Name      string
+	Currency  string
+	AccountID string
+	Deleted   bool
+	Created   time.Time
+	Updated   time.Time
+
+	// Balance is in minor units.
+	Balance int64
+}
+
+// Transaction is a transaction held by the fake server.
+type Transaction struct {
+	ID            string
+	AccountID     string
+	Amount        int64
+	Currency      string
+	Description   string
+	Notes         string
+	Category      string
+	Scheme        string
+	DedupeID      string
+	DeclineReason string
+	IsLoad        bool
+	Metadata      map[string]string
+	Created       time.Time
+	Labels        []string
+
+	// LocalAmount and LocalCurrency default to Amount and
+	// Currency.
+	LocalAmount   int64
+	LocalCurrency string
+
+	// AmountIsPending marks a transaction whose amount may still
+	// change before it settles.
+	AmountIsPending bool
+
+	// Counterparty is set for bank transfers and payments
+	// between Monzo users.
+	Counterparty *Counterparty
+
+	// Merchant is sent in full when the merchant is expanded,
+	// and as its ID otherwise.
+	Merchant *Merchant
+
+	// Settled is left zero for pending transactions.
+	Settled time.Time
+
+	// AccountBalance is the account's balance after the
+	// transaction. It is set by the server.
+	AccountBalance int64
+}
+
+// Counterparty is the other side of a transfer.
+type Counterparty struct {
+	Name          string
+	AccountNumber string
+	SortCode      string
+	UserID        string
+	AccountID     string
+}
+
+// Merchant is where a transaction took place.
+type Merchant struct {
+	ID       string
+	GroupID  string
+	Name     string
+	Logo     string
+	Emoji    string
+	Category string
+	Online   bool
+	ATM      bool
+	Address  MerchantAddress
+	Metadata map[string]string
+}
+
+// MerchantAddress is the location of a Merchant.
+type MerchantAddress struct {
+	Address   string
+	City      string
+	Region    string
+	Country   string
+	Postcode  string
+	Latitude  float64
+	Longitude float64
+}
+
+// Attachment is a file registered against a transaction.
+type Attachment struct {
+	ID            string
+	TransactionID string
+	FileURL       string
+	FileType      string
+	Created       time.Time
+
+	// Data is the uploaded file, if it was uploaded to the
+	// server's own upload URL.
+	Data []byte
+}
+
+// FeedItem is an item that has been added to an account's feed.
+type FeedItem struct {
+	AccountID string
+	Type      string
+	URL       string
+	Params    map[string]string
+}
+
+// Webhook is a webhook registered with the fake server.
+type Webhook struct {
+	ID        string
+	AccountID string
+	URL       string
+}
+
+// AddAccount adds an account to the server. An ID is generated
+// if a is missing one, and the stored account is returned.
+func (s *Server) AddAccount(a Account) Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.ID == "" {
+		a.ID = s.newID("acc")
+	}
+
+	if a.Type == "" {
+		a.Type = "uk_retail"
+	}
+
+	if a.Currency == "" {
+		a.Currency = "GBP"
+	}
+
+	if a.CountryCode == "" {
+		a.CountryCode = "GB"
+	}
+
+	if a.Created.IsZero() {
+		a.Created = s.now()
+	}
+
+	s.accounts = append(s.accounts, &a)
+	return a
+}
+
+// AddPot adds a pot to the server. An ID is generated if p is
+// missing one, and the stored pot is returned.
+func (s *Server) AddPot(p Pot) Pot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.ID == "" {
+		p.ID = s.newID("pot")
+	}
+
+	if p.Currency == "" {
+		p.Currency = "GBP"
+	}
+
+	if p.Created.IsZero() {
+		p.Created = s.now()
+	}
+
+	if p.Updated.IsZero() {
+		p.Updated = p.Created
+	}
+
+	s.pots = append(s.pots, &p)
+	return p
+}
+
+// AddTransaction adds a transaction to the server and applies
+// its amount to the account's balance, unless it was declined.
+// An ID is generated if t is missing one, and the stored
+// transaction is returned.
+func (s *Server) AddTransaction(t Transaction) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(t.AccountID)
+	if acc == nil {
+		return Transaction{}, fmt.Errorf("no account found with ID %s", t.AccountID)
+	}
+
+	return *s.addTransaction(acc, t), nil
+}
+
+// addTransaction must be called with s.mu held.
+func (s *Server) addTransaction(acc *Account, t Transaction) *Transaction {
+	if t.ID == "" {
+		t.ID = s.newID("tx")
+	}
+
+	if t.Currency == "" {
+		t.Currency = acc.Currency
+	}
+
+	if t.LocalCurrency == "" {
+		t.LocalAmount = t.Amount
+		t.LocalCurrency = t.Currency
+	}
+
+	if t.Created.IsZero() {
+		t.Created = s.now()
+	}
+
+	if t.Metadata == nil {
+		t.Metadata = make(map[string]string)
+	}
+
+	if t.Merchant != nil && t.Merchant.ID == "" {
+		m := *t.Merchant
+		m.ID = s.newID("merch")
+		t.Merchant = &m
+	}
+
+	if t.DeclineReason == "" {
+		acc.Balance += t.Amount
+	}
+
+	t.AccountBalance = acc.Balance
+
+	s.transactions = append(s.transactions, &t)
+
+	// Transactions are kept in the order they were created in,
+	// which isn't necessarily the order they were added in.
+	sort.SliceStable(s.transactions, func(i, j int) bool {
+		return s.transactions[i].Created.Before(s.transactions[j].Created)
+	})
+
+	return &t
+}
+
+// Account returns the account with the given ID.
+func (s *Server) Account(id string) (Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a := s.account(id); a != nil {
+		return *a, true
+	}
+
+	return Account{}, false
+}
+
+// Pot returns the pot with the given ID.
+func (s *Server) Pot(id string) (Pot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p := s.pot(id); p != nil {
+		return *p, true
+	}
+
+	return Pot{}, false
+}
+
+// Transaction returns the transaction with the given ID.
+func (s *Server) Transaction(id string) (Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t := s.transaction(id); t != nil {
+		return *t, true
+	}
+
+	return Transaction{}, false
+}
+
+// Transactions returns the transactions for an account, oldest
+// first.
+func (s *Server) Transactions(accountID string) []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var txs []Transaction
+	for _, t := range s.transactions {
+		if t.AccountID == accountID {
+			txs = append(txs, *t)
+		}
+	}
+
+	return txs
+}
+
+// SettleTransaction marks a pending transaction as settled, which
+// also fixes its amount.
+func (s *Server) SettleTransaction(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.transaction(id)
+	if t == nil {
+		return fmt.Errorf("no transaction found with ID %s", id)
+	}
+
+	t.Settled = at
+	t.AmountIsPending = false
+	return nil
+}
+
+// ChangeTransactionAmount changes the amount of a transaction,
+// as happens when a pending card payment settles for a different
+// amount, and applies the difference to the account's balance.
+func (s *Server) ChangeTransactionAmount(id string, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.transaction(id)
+	if t == nil {
+		return fmt.Errorf("no transaction found with ID %s", id)
+	}
+
+	if t.DeclineReason == "" {
+		if acc := s.account(t.AccountID); acc != nil {
+			acc.Balance += amount - t.Amount
+		}
+	}
+
+	if t.LocalCurrency == t.Currency {
+		t.LocalAmount = amount
+	}
+
+	t.Amount = amount
+	return nil
+}
+
+// FeedItems returns the items that have been added to the feed
+// of an account.
+func (s *Server) FeedItems(accountID string) []FeedItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []FeedItem
+	for _, fi := range s.feed {
+		if fi.AccountID == accountID {
+			items = append(items, fi)
+		}
+	}
+
+	return items
+}
+
+// Receipt returns the raw JSON of the receipt stored with the
+// given external ID.
+func (s *Server) Receipt(externalID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.receipts[externalID]
+	return r, ok
+}
+
+// Attachments returns the attachments registered against a
+// transaction.
+func (s *Server) Attachments(transactionID string) []Attachment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var atts []Attachment
+	for _, a := range s.attachments {
+		if a.TransactionID == transactionID {
+			att := *a
+			att.Data = s.uploads[a.FileURL]
+			atts = append(atts, att)
+		}
+	}
+
+	return atts
+}
+
+// Webhooks returns the webhooks registered for an account.
+func (s *Server) Webhooks(accountID string) []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var hooks []Webhook
+	for _, w := range s.webhooks {
+		if w.AccountID == accountID {
+			hooks = append(hooks, *w)
+		}
+	}
+
+	return hooks
+}
+
+func (s *Server) account(id string) *Account {
+	for _, a := range s.accounts {
+		if a.ID == id {
+			return a
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) pot(id string) *Pot {
+	for _, p := range s.pots {
+		if p.ID == id {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) transaction(id string) *Transaction {
+	for _, t := range s.transactions {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// newID must be called with s.mu held.
+func (s *Server) newID(prefix string) string {
+	s.ids++
+	return fmt.Sprintf("%s_%016d", prefix, s.ids)
+}
+
+// now returns the server's clock, which never goes backwards so
+// that transactions added one after the other are ordered.
+// It must be called with s.mu held.
+func (s *Server) now() time.Time {
+	t := s.Now().UTC()
+	if !t.After(s.last) {
+		t = s.last.Add(time.Microsecond)
+	}
+
+	s.last = t
+	return t
+}
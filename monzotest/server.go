@@ -0,0 +1,589 @@
+// Package monzotest provides an in-process fake of the Monzo API
+// for testing code that uses github.com/tmus/monzo.
+//
+// The fake is backed by an in-memory ledger that can be seeded
+// with accounts, pots and transactions. Moving money in and out
+// of pots changes the balances it reports, and dedupe IDs are
+// honored the same way Monzo honors them.
+//
+//	srv := monzotest.NewServer("token")
+//	defer srv.Close()
+//
+//	acc := srv.AddAccount(monzotest.Account{Balance: 10000})
+//	c := monzo.NewClient("token", monzo.WithBaseURL(srv.URL))
+package monzotest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake Monzo API.
+type Server struct {
+	*httptest.Server
+
+	// Token is the access token that requests must carry. If it
+	// is empty, any token is accepted.
+	Token string
+
+	// Now is the clock used to timestamp new resources. It
+	// defaults to time.Now.
+	Now func() time.Time
+
+	mu           sync.Mutex
+	ids          int
+	last         time.Time
+	accounts     []*Account
+	pots         []*Pot
+	transactions []*Transaction
+	feed         []FeedItem
+	webhooks     []*Webhook
+	receipts     map[string][]byte
+	attachments  []*Attachment
+
+	// uploads holds files PUT to upload URLs, keyed by the file
+	// URL they are served from.
+	uploads map[string][]byte
+
+	// dedupe holds the response sent for each dedupe ID, so
+	// that a repeated request gets the same response without
+	// moving money again.
+	dedupe map[string][]byte
+}
+
+// NewServer starts a fake Monzo API that accepts token. It must
+// be closed when the test is done with it.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:    token,
+		Now:      time.Now,
+		receipts: make(map[string][]byte),
+		uploads:  make(map[string][]byte),
+		dedupe:   make(map[string][]byte),
+	}
+
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// ServeHTTP routes requests to the fake endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Upload URLs are pre-signed, so like Monzo's they don't
+	// need the access token.
+	if r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/upload/") {
+		s.receiveUpload(w, r)
+		return
+	}
+
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "unauthorized.bad_access_token", "Access token is invalid")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/ping/whoami":
+		writeJSON(w, map[string]interface{}{"authenticated": true})
+	case r.Method == http.MethodGet && r.URL.Path == "/accounts":
+		s.listAccounts(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/balance":
+		s.balance(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/pots":
+		s.listPots(w, r)
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[0] == "pots" && parts[2] == "deposit":
+		s.movePot(w, r, parts[1], true)
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[0] == "pots" && parts[2] == "withdraw":
+		s.movePot(w, r, parts[1], false)
+	case r.Method == http.MethodGet && r.URL.Path == "/transactions":
+		s.listTransactions(w, r)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "transactions":
+		s.getTransaction(w, r, parts[1])
+	case r.Method == http.MethodPatch && len(parts) == 2 && parts[0] == "transactions":
+		s.annotateTransaction(w, r, parts[1])
+	case r.Method == http.MethodPut && r.URL.Path == "/transaction-receipts":
+		s.putReceipt(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/transaction-receipts":
+		s.getReceipt(w, r)
+	case r.Method == http.MethodDelete && r.URL.Path == "/transaction-receipts":
+		s.deleteReceipt(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/attachment/upload":
+		s.requestUpload(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/attachment/register":
+		s.registerAttachment(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/attachment/deregister":
+		s.deregisterAttachment(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/feed":
+		s.addFeedItem(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/webhooks":
+		s.listWebhooks(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/webhooks":
+		s.registerWebhook(w, r)
+	case r.Method == http.MethodDelete && len(parts) == 2 && parts[0] == "webhooks":
+		s.deleteWebhook(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "Endpoint not found")
+	}
+}
+
+func (s *Server) listAccounts(w http.ResponseWriter, r *http.Request) {
+	accs := []interface{}{}
+	for _, a := range s.accounts {
+		accs = append(accs, accountJSON(a))
+	}
+
+	writeJSON(w, map[string]interface{}{"accounts": accs})
+}
+
+func (s *Server) balance(w http.ResponseWriter, r *http.Request) {
+	acc := s.account(r.URL.Query().Get("account_id"))
+	if acc == nil {
+		writeError(w, http.StatusNotFound, "not_found.account", "Account not found")
+		return
+	}
+
+	total := acc.Balance
+	for _, p := range s.pots {
+		if p.AccountID == acc.ID && !p.Deleted {
+			total += p.Balance
+		}
+	}
+
+	var spent int64
+	today := s.Now().UTC().Truncate(24 * time.Hour)
+	for _, t := range s.transactions {
+		if t.AccountID == acc.ID && t.Amount < 0 && t.DeclineReason == "" && !t.Created.Before(today) {
+			spent += t.Amount
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"balance":                            acc.Balance,
+		"total_balance":                      total,
+		"balance_including_flexible_savings": total,
+		"currency":                           acc.Currency,
+		"spend_today":                        spent,
+	})
+}
+
+func (s *Server) listPots(w http.ResponseWriter, r *http.Request) {
+	pots := []interface{}{}
+	for _, p := range s.pots {
+		if id := r.URL.Query().Get("current_account_id"); id != "" && p.AccountID != id {
+			continue
+		}
+
+		pots = append(pots, potJSON(p))
+	}
+
+	writeJSON(w, map[string]interface{}{"pots": pots})
+}
+
+// movePot moves money between a pot and an account, depositing
+// into the pot if deposit is true and withdrawing otherwise.
+func (s *Server) movePot(w http.ResponseWriter, r *http.Request, id string, deposit bool) {
+	r.ParseForm()
+
+	accField := "destination_account_id"
+	if deposit {
+		accField = "source_account_id"
+	}
+
+	dedupeID := r.PostForm.Get("dedupe_id")
+	if dedupeID == "" {
+		writeError(w, http.StatusBadRequest, "bad_request.missing_param.dedupe_id", "Missing dedupe_id")
+		return
+	}
+
+	key := r.URL.Path + "|" + dedupeID
+	if resp, ok := s.dedupe[key]; ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+		return
+	}
+
+	amount, err := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.amount", "Amount must be a positive integer")
+		return
+	}
+
+	pot := s.pot(id)
+	if pot == nil || pot.Deleted {
+		writeError(w, http.StatusNotFound, "not_found.pot", "Pot not found")
+		return
+	}
+
+	acc := s.account(r.PostForm.Get(accField))
+	if acc == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param."+accField, "Account not found")
+		return
+	}
+
+	if deposit && acc.Balance < amount || !deposit && pot.Balance < amount {
+		writeError(w, http.StatusBadRequest, "bad_request.insufficient_funds", "Insufficient funds")
+		return
+	}
+
+	desc := pot.ID
+	if deposit {
+		pot.Balance += amount
+		amount = -amount
+	} else {
+		pot.Balance -= amount
+	}
+	pot.Updated = s.now()
+
+	s.addTransaction(acc, Transaction{
+		AccountID:   acc.ID,
+		Amount:      amount,
+		Description: desc,
+		Category:    "savings",
+		Scheme:      "uk_retail_pot",
+		DedupeID:    dedupeID,
+		Settled:     pot.Updated,
+		Metadata:    map[string]string{"pot_id": pot.ID},
+	})
+
+	resp, _ := json.Marshal(potJSON(pot))
+	s.dedupe[key] = resp
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	acc := s.account(q.Get("account_id"))
+	if acc == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.account_id", "Account not found")
+		return
+	}
+
+	limit := 100
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "bad_request.bad_param.limit", "Limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	var before time.Time
+	if b := q.Get("before"); b != "" {
+		t, err := time.Parse(time.RFC3339Nano, b)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request.bad_param.before", "Before must be a timestamp")
+			return
+		}
+		before = t
+	}
+
+	// Since is either a timestamp, which is inclusive, or a
+	// transaction ID, which is exclusive.
+	var since time.Time
+	var sinceID string
+	if sn := q.Get("since"); sn != "" {
+		if t, err := time.Parse(time.RFC3339Nano, sn); err == nil {
+			since = t
+		} else if tx := s.transaction(sn); tx != nil {
+			since, sinceID = tx.Created, tx.ID
+		} else {
+			writeError(w, http.StatusBadRequest, "bad_request.bad_param.since", "Since must be a timestamp or transaction ID")
+			return
+		}
+	}
+
+	txs := []interface{}{}
+	for _, t := range s.transactions {
+		if len(txs) == limit {
+			break
+		}
+
+		if t.AccountID != acc.ID || t.ID == sinceID || t.Created.Before(since) {
+			continue
+		}
+
+		if !before.IsZero() && !t.Created.Before(before) {
+			continue
+		}
+
+		txs = append(txs, s.transactionJSON(t, expandMerchant(r)))
+	}
+
+	writeJSON(w, map[string]interface{}{"transactions": txs})
+}
+
+func (s *Server) getTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	t := s.transaction(id)
+	if t == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"transaction": s.transactionJSON(t, expandMerchant(r))})
+}
+
+// annotateTransaction sets metadata on a transaction. Like
+// Monzo, an empty value deletes the key, and the notes key
+// also sets the transaction's notes.
+func (s *Server) annotateTransaction(w http.ResponseWriter, r *http.Request, id string) {
+	t := s.transaction(id)
+	if t == nil {
+		writeError(w, http.StatusNotFound, "not_found.transaction", "Transaction not found")
+		return
+	}
+
+	r.ParseForm()
+	for field, values := range r.PostForm {
+		if !strings.HasPrefix(field, "metadata[") || !strings.HasSuffix(field, "]") {
+			continue
+		}
+
+		key := field[len("metadata[") : len(field)-1]
+		value := values[0]
+
+		if key == "notes" {
+			t.Notes = value
+		}
+
+		if value == "" {
+			delete(t.Metadata, key)
+		} else {
+			t.Metadata[key] = value
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{"transaction": s.transactionJSON(t, expandMerchant(r))})
+}
+
+func (s *Server) putReceipt(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	var receipt struct {
+		TransactionID string `json:"transaction_id"`
+		ExternalID    string `json:"external_id"`
+	}
+	if err := json.Unmarshal(body, &receipt); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request.invalid_json", err.Error())
+		return
+	}
+
+	if receipt.ExternalID == "" {
+		writeError(w, http.StatusBadRequest, "bad_request.missing_param.external_id", "Missing external_id")
+		return
+	}
+
+	if s.transaction(receipt.TransactionID) == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.transaction_id", "Transaction not found")
+		return
+	}
+
+	s.receipts[receipt.ExternalID] = body
+	writeJSON(w, map[string]interface{}{"receipt_id": "receipt_" + receipt.ExternalID})
+}
+
+// requestUpload hands out a URL to upload an attachment to, on
+// the server itself.
+func (s *Server) requestUpload(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	for _, field := range []string{"file_name", "file_type", "content_length"} {
+		if r.PostForm.Get(field) == "" {
+			writeError(w, http.StatusBadRequest, "bad_request.missing_param."+field, "Missing "+field)
+			return
+		}
+	}
+
+	id := s.newID("upload")
+	writeJSON(w, map[string]interface{}{
+		"file_url":   s.URL + "/files/" + id + "/" + r.PostForm.Get("file_name"),
+		"upload_url": s.URL + "/upload/" + id + "/" + r.PostForm.Get("file_name"),
+	})
+}
+
+func (s *Server) receiveUpload(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.uploads[s.URL+"/files/"+strings.TrimPrefix(r.URL.Path, "/upload/")] = body
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) registerAttachment(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	t := s.transaction(r.PostForm.Get("external_id"))
+	if t == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.external_id", "Transaction not found")
+		return
+	}
+
+	a := &Attachment{
+		ID:            s.newID("attach"),
+		TransactionID: t.ID,
+		FileURL:       r.PostForm.Get("file_url"),
+		FileType:      r.PostForm.Get("file_type"),
+		Created:       s.now(),
+	}
+
+	s.attachments = append(s.attachments, a)
+	writeJSON(w, map[string]interface{}{"attachment": attachmentJSON(a)})
+}
+
+func (s *Server) deregisterAttachment(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	for i, a := range s.attachments {
+		if a.ID == r.PostForm.Get("id") {
+			s.attachments = append(s.attachments[:i], s.attachments[i+1:]...)
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "not_found.attachment", "Attachment not found")
+}
+
+func (s *Server) getReceipt(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("external_id")
+
+	body, ok := s.receipts[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found.receipt", "Receipt not found")
+		return
+	}
+
+	var receipt map[string]interface{}
+	json.Unmarshal(body, &receipt)
+	receipt["id"] = "receipt_" + id
+
+	writeJSON(w, map[string]interface{}{"receipt": receipt})
+}
+
+func (s *Server) deleteReceipt(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("external_id")
+
+	if _, ok := s.receipts[id]; !ok {
+		writeError(w, http.StatusNotFound, "not_found.receipt", "Receipt not found")
+		return
+	}
+
+	delete(s.receipts, id)
+	writeJSON(w, map[string]interface{}{})
+}
+
+func (s *Server) addFeedItem(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	if s.account(r.PostForm.Get("account_id")) == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.account_id", "Account not found")
+		return
+	}
+
+	fi := FeedItem{
+		AccountID: r.PostForm.Get("account_id"),
+		Type:      r.PostForm.Get("type"),
+		URL:       r.PostForm.Get("url"),
+		Params:    make(map[string]string),
+	}
+
+	for field, values := range r.PostForm {
+		if strings.HasPrefix(field, "params[") && strings.HasSuffix(field, "]") {
+			fi.Params[field[len("params["):len(field)-1]] = values[0]
+		}
+	}
+
+	s.feed = append(s.feed, fi)
+	writeJSON(w, map[string]interface{}{})
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks := []interface{}{}
+	for _, h := range s.webhooks {
+		if h.AccountID == r.URL.Query().Get("account_id") {
+			hooks = append(hooks, webhookJSON(h))
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{"webhooks": hooks})
+}
+
+func (s *Server) registerWebhook(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	if s.account(r.PostForm.Get("account_id")) == nil {
+		writeError(w, http.StatusBadRequest, "bad_request.bad_param.account_id", "Account not found")
+		return
+	}
+
+	h := &Webhook{
+		ID:        s.newID("webhook"),
+		AccountID: r.PostForm.Get("account_id"),
+		URL:       r.PostForm.Get("url"),
+	}
+
+	s.webhooks = append(s.webhooks, h)
+	writeJSON(w, map[string]interface{}{"webhook": webhookJSON(h)})
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request, id string) {
+	for i, h := range s.webhooks {
+		if h.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "not_found.webhook", "Webhook not found")
+}
+
+// expandMerchant reports whether the request asked for merchants
+// to be sent in full.
+func expandMerchant(r *http.Request) bool {
+	for _, e := range r.URL.Query()["expand[]"] {
+		if e == "merchant" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds in the same shape as Monzo's errors.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"params":  map[string]string{},
+	})
+}
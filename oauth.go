@@ -0,0 +1,267 @@
+package monzo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthURL is where users are sent to authorize an OAuth client.
+const AuthURL string = "https://auth.monzo.com/"
+
+// TokenURL is where authorization codes and refresh tokens are
+// exchanged for access tokens.
+const TokenURL string = APIBase + "/oauth2/token"
+
+// expiryDelta is how long before its expiry a Token is treated
+// as expired, so that it isn't rejected mid-request.
+const expiryDelta = time.Minute
+
+// Token holds the credentials Monzo issues through OAuth.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ClientID     string    `json:"client_id"`
+	UserID       string    `json:"user_id"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// Valid reports whether the access token can still be used. A
+// Token without an Expiry never expires.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry)
+}
+
+// TokenSource supplies the access token used to authorize each
+// request. It must be safe for concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// tokenRefresher is implemented by TokenSources that can replace
+// an access token Monzo has rejected.
+type tokenRefresher interface {
+	refresh(ctx context.Context, stale string) (*Token, error)
+}
+
+// WithTokenSource authorizes requests with tokens from ts rather
+// than the static Client.Token. If ts was created by
+// OAuthConfig.TokenSource, a request that Monzo rejects as
+// unauthorized is retried once with a refreshed token.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) {
+		c.tokens = ts
+	}
+}
+
+// OAuthConfig describes an OAuth client registered with Monzo at
+// https://developers.monzo.com.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// AuthURL and TokenURL default to the package constants of
+	// the same name.
+	AuthURL  string
+	TokenURL string
+
+	// HTTPClient is used to talk to the token endpoint. If it is
+	// nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// NewOAuthState returns a random string to pass to AuthCodeURL
+// and check against the state Monzo redirects back with.
+func NewOAuthState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL to send a user to so that they can
+// authorize the client. Monzo redirects back to RedirectURL with
+// a code to pass to Exchange and the given state.
+func (o *OAuthConfig) AuthCodeURL(state string) string {
+	base := o.AuthURL
+	if base == "" {
+		base = AuthURL
+	}
+
+	q := url.Values{}
+	q.Set("client_id", o.ClientID)
+	q.Set("redirect_uri", o.RedirectURL)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	if strings.Contains(base, "?") {
+		return base + "&" + q.Encode()
+	}
+
+	return base + "?" + q.Encode()
+}
+
+// Exchange swaps an authorization code for a Token.
+func (o *OAuthConfig) Exchange(ctx context.Context, code string) (*Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("redirect_uri", o.RedirectURL)
+	data.Set("code", code)
+
+	tok, err := o.token(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	return tok, nil
+}
+
+// Refresh swaps a refresh token for a new Token. Monzo refresh
+// tokens can only be used once, so the returned Token must be
+// kept in place of the old one.
+func (o *OAuthConfig) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+
+	tok, err := o.token(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	return tok, nil
+}
+
+func (o *OAuthConfig) token(ctx context.Context, data url.Values) (*Token, error) {
+	endpoint := o.TokenURL
+	if endpoint == "" {
+		endpoint = TokenURL
+	}
+
+	data.Set("client_id", o.ClientID)
+	data.Set("client_secret", o.ClientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	hc := o.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	// Token requests are never retried: a refresh token that
+	// reached Monzo has been used up, even if the response
+	// didn't make it back.
+	c := &Client{Client: *hc}
+
+	var resp struct {
+		Token
+		ExpiresIn int `json:"expires_in"`
+	}
+	if err := c.send(req, "", &resp); err != nil {
+		return nil, err
+	}
+
+	tok := resp.Token
+	if resp.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	return &tok, nil
+}
+
+// TokenSource returns a TokenSource that starts with t and
+// refreshes it when it expires or is rejected by Monzo. Only one
+// refresh happens at a time, however many requests are waiting.
+// Refreshed tokens are only kept in memory; use
+// StoredTokenSource to persist them.
+func (o *OAuthConfig) TokenSource(t *Token) TokenSource {
+	return o.StoredTokenSource(NewMemoryTokenStore(t))
+}
+
+type refreshingTokenSource struct {
+	conf  *OAuthConfig
+	store TokenStore
+
+	// tok caches the last Token seen so that the store isn't
+	// read for every request.
+	mu  sync.Mutex
+	tok *Token
+}
+
+func (s *refreshingTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok.Valid() {
+		return s.tok, nil
+	}
+
+	// The store may hold a newer token than the cache, saved
+	// by another process.
+	tok, err := s.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Valid() {
+		s.tok = tok
+		return tok, nil
+	}
+
+	return s.renew(ctx, tok.AccessToken)
+}
+
+func (s *refreshingTokenSource) refresh(ctx context.Context, stale string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.renew(ctx, stale)
+}
+
+// renew refreshes the stored token, unless it has already been
+// replaced since stale was handed out. It must be called with
+// s.mu held.
+func (s *refreshingTokenSource) renew(ctx context.Context, stale string) (*Token, error) {
+	err := s.store.Update(ctx, func(cur *Token) (*Token, error) {
+		if cur != nil && cur.AccessToken != stale && cur.Valid() {
+			return cur, nil
+		}
+
+		if cur == nil || cur.RefreshToken == "" {
+			return nil, fmt.Errorf("access token has expired and there is no refresh token")
+		}
+
+		return s.conf.Refresh(ctx, cur.RefreshToken)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := s.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.tok = tok
+	return tok, nil
+}
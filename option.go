@@ -0,0 +1,52 @@
+package monzo
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a Client when it is created with NewClient.
+type Option func(*Client)
+
+// WithBaseURL points the Client at a different root than
+// APIBase, such as a local stand-in server or a proxy.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = url
+	}
+}
+
+// WithHTTPClient replaces the http.Client used to make
+// requests. The passed client is copied, so changing it
+// afterwards has no effect on the Monzo Client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.Client = *hc
+		}
+	}
+}
+
+// WithTransport sets the RoundTripper used to make requests,
+// leaving the rest of the http.Client untouched.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.Client.Transport = rt
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every
+// request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithTimeout sets the time limit for each request made by
+// the Client, including reading the response body.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.Client.Timeout = d
+	}
+}
@@ -0,0 +1,198 @@
+package orderimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Parse reads the Orders from an email or an HTML document,
+// working out which it has been given from its content.
+//
+// JSON-LD blocks and Orders that can't be read are skipped. They
+// are reported with a *SkippedError, which is returned alongside
+// the Orders that could be read.
+func Parse(r io.Reader) ([]*Order, error) {
+	br := bufio.NewReader(r)
+
+	peek, _ := br.Peek(512)
+	if isHTML(peek) {
+		return ParseHTML(br)
+	}
+
+	return ParseEmail(br)
+}
+
+// ParseFile reads the Orders from an .eml or .html file.
+func ParseFile(path string) ([]*Order, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".eml":
+		return ParseEmail(f)
+	case ".html", ".htm":
+		return ParseHTML(f)
+	}
+
+	return Parse(f)
+}
+
+// ParseEmail reads the Orders from the HTML parts of an RFC 5322
+// email, such as an .eml file.
+func ParseEmail(r io.Reader) ([]*Order, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %w", err)
+	}
+
+	var parts [][]byte
+	err = htmlParts(
+		msg.Header.Get("Content-Type"),
+		msg.Header.Get("Content-Transfer-Encoding"),
+		msg.Body,
+		&parts,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %w", err)
+	}
+
+	var orders []*Order
+	var bad []error
+	for _, part := range parts {
+		o, b := parseHTML(part)
+		orders = append(orders, o...)
+		bad = append(bad, b...)
+	}
+
+	return found(orders, bad)
+}
+
+// ParseHTML reads the Orders from the JSON-LD scripts in an HTML
+// document.
+func ParseHTML(r io.Reader) ([]*Order, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return found(parseHTML(data))
+}
+
+// found returns the Orders with any skipped errors, or
+// ErrNoOrder if there are none.
+func found(orders []*Order, bad []error) ([]*Order, error) {
+	if len(orders) == 0 {
+		if len(bad) > 0 {
+			return nil, fmt.Errorf("%w: %v", ErrNoOrder, skipped(bad))
+		}
+		return nil, ErrNoOrder
+	}
+
+	return orders, skipped(bad)
+}
+
+var jsonLDScript = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// parseHTML reads the Orders from each JSON-LD script in data.
+// Scripts and Orders that can't be read are returned in bad
+// rather than stopping the rest from being read.
+func parseHTML(data []byte) (orders []*Order, bad []error) {
+	for n, m := range jsonLDScript.FindAllSubmatch(data, -1) {
+		script := bytes.TrimSpace(m[1])
+
+		o, b, err := parseJSONLD(script)
+		if err != nil {
+			// Some mailers escape the script as if it were
+			// text, so try again with the entities decoded.
+			var uerr error
+			o, b, uerr = parseJSONLD([]byte(html.UnescapeString(string(script))))
+			if uerr != nil {
+				bad = append(bad, fmt.Errorf("JSON-LD script %d: %w", n+1, err))
+				continue
+			}
+		}
+
+		orders = append(orders, o...)
+		bad = append(bad, b...)
+	}
+
+	return orders, bad
+}
+
+// htmlParts appends the decoded text/html parts of a MIME entity
+// to parts, walking into multipart entities.
+func htmlParts(contentType, encoding string, body io.Reader, parts *[][]byte) error {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			err = htmlParts(
+				p.Header.Get("Content-Type"),
+				p.Header.Get("Content-Transfer-Encoding"),
+				p,
+				parts,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if mediaType != "text/html" {
+		return nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	*parts = append(*parts, data)
+	return nil
+}
+
+// isHTML reports whether a document starts like HTML rather than
+// with email headers.
+func isHTML(peek []byte) bool {
+	s := strings.ToLower(strings.TrimSpace(string(peek)))
+	return strings.HasPrefix(s, "<")
+}
@@ -0,0 +1,160 @@
+package orderimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tmus/monzo"
+)
+
+// MatchBefore and MatchAfter are how far either side of an
+// order's date a payment for it is looked for. Card payments for
+// online orders are often taken when the order ships, some days
+// later.
+var (
+	MatchBefore = 24 * time.Hour
+	MatchAfter  = 7 * 24 * time.Hour
+)
+
+// Match returns the Transaction that most likely paid for the
+// Order: a payment of the order's total, in either the account's
+// or the local currency, made closest to the order's date. It
+// reports false if none of the transactions match.
+func Match(o *Order, transactions []monzo.Transaction) (monzo.Transaction, bool) {
+	var best monzo.Transaction
+	var bestGap time.Duration
+	found := false
+
+	for _, t := range transactions {
+		if !pays(t, o.Total) {
+			continue
+		}
+
+		if !o.Date.IsZero() {
+			if t.Created.Before(o.Date.Add(-MatchBefore)) || t.Created.After(o.Date.Add(MatchAfter)) {
+				continue
+			}
+		}
+
+		gap := t.Created.Sub(o.Date)
+		if gap < 0 {
+			gap = -gap
+		}
+
+		if !found || gap < bestGap {
+			best, bestGap, found = t, gap, true
+		}
+	}
+
+	return best, found
+}
+
+// pays reports whether t is a payment of total.
+func pays(t monzo.Transaction, total monzo.Money) bool {
+	if t.IsDeclined() || t.IsPotTransfer() || total.Currency == "" {
+		return false
+	}
+
+	spent := t.Money()
+	if t.LocalCurrency == total.Currency && t.LocalCurrency != t.Currency {
+		spent = t.LocalMoney()
+	}
+
+	paid, err := spent.Neg()
+	if err != nil {
+		return false
+	}
+
+	return paid.Currency == total.Currency && paid.Amount == total.Amount
+}
+
+// Proposal pairs an Order with the Receipt built from it and the
+// Transaction it is proposed to be attached to.
+type Proposal struct {
+	Order       *Order
+	Receipt     *monzo.Receipt
+	Transaction monzo.Transaction
+}
+
+// Matched reports whether a Transaction was found for the Order.
+func (p Proposal) Matched() bool {
+	return p.Transaction.ID != ""
+}
+
+// Attach saves the Receipt against the proposed Transaction.
+func (p Proposal) Attach(ctx context.Context) error {
+	if !p.Matched() {
+		return fmt.Errorf("order %s has no matching transaction", p.Order.OrderNumber)
+	}
+
+	return p.Transaction.AddReceiptContext(ctx, p.Receipt)
+}
+
+// Import reads the Orders from an email or HTML document and
+// proposes a Transaction on the account for each of them. Check
+// the proposals and call Attach on the ones to keep.
+//
+// Anything skipped while reading the document or building the
+// receipts is reported with a *SkippedError, which is returned
+// alongside the proposals.
+func Import(ctx context.Context, acc monzo.Account, r io.Reader) ([]Proposal, error) {
+	orders, err := Parse(r)
+
+	var bad []error
+	var skip *SkippedError
+	if errors.As(err, &skip) {
+		bad = skip.Errs
+	} else if err != nil {
+		return nil, err
+	}
+
+	proposals, err := Propose(ctx, acc, orders)
+	if errors.As(err, &skip) {
+		bad = append(bad, skip.Errs...)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return proposals, skipped(bad)
+}
+
+// Propose builds a Receipt for each Order and looks for the
+// Transaction on the account that paid for it. Orders that a
+// Receipt can't be built for, such as those with no items, are
+// skipped and reported with a *SkippedError, which is returned
+// alongside the proposals for the rest.
+func Propose(ctx context.Context, acc monzo.Account, orders []*Order) ([]Proposal, error) {
+	proposals := make([]Proposal, 0, len(orders))
+	var bad []error
+
+	for _, o := range orders {
+		receipt, err := o.Receipt()
+		if err != nil {
+			bad = append(bad, err)
+			continue
+		}
+
+		p := Proposal{Order: o, Receipt: receipt}
+
+		since, before := o.Date.Add(-MatchBefore), o.Date.Add(MatchAfter)
+		if o.Date.IsZero() {
+			since, before = time.Time{}, time.Now()
+		}
+
+		transactions, err := acc.TransactionsBetweenContext(ctx, since, before)
+		if err != nil {
+			return nil, err
+		}
+
+		if t, ok := Match(o, transactions); ok {
+			p.Transaction = t
+		}
+
+		proposals = append(proposals, p)
+	}
+
+	return proposals, skipped(bad)
+}
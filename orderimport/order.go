@@ -0,0 +1,549 @@
+// Package orderimport builds Monzo receipts from the schema.org
+// Order and Invoice markup that many retailers embed as JSON-LD
+// in their order confirmation emails.
+//
+// Orders can be read from an .eml file or from HTML, turned into
+// a monzo.Receipt, and matched to the Transaction that paid for
+// them:
+//
+//	proposals, err := orderimport.Import(ctx, acc, f)
+//	for _, p := range proposals {
+//		if p.Matched() {
+//			err = p.Attach(ctx)
+//		}
+//	}
+package orderimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmus/monzo"
+)
+
+// ErrNoOrder is returned when a document has no schema.org Order
+// or Invoice in it.
+var ErrNoOrder = errors.New("no order found")
+
+// SkippedError reports the parts of the input that were skipped
+// because they couldn't be used, such as a JSON-LD block that
+// doesn't parse or an Order with no items. It is returned
+// alongside whatever could be used.
+type SkippedError struct {
+	Errs []error
+}
+
+func (e *SkippedError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("skipped %d: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+// skipped returns a *SkippedError for errs, or nil if there
+// are none.
+func skipped(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &SkippedError{Errs: errs}
+}
+
+// Order is a schema.org Order or Invoice.
+type Order struct {
+	OrderNumber string
+	Merchant    string
+	Date        time.Time
+	Items       []LineItem
+	Taxes       []Tax
+
+	// Total is the amount paid for the order. If the markup
+	// doesn't give one, it is the sum of the Items.
+	Total monzo.Money
+}
+
+// LineItem is a single product on an Order.
+type LineItem struct {
+	Name     string
+	Quantity int
+
+	// Price is the cost of the whole line, so the unit price
+	// multiplied by the Quantity.
+	Price monzo.Money
+}
+
+// Tax is a tax charged on an Order.
+type Tax struct {
+	Name   string
+	Amount monzo.Money
+}
+
+// Receipt builds a monzo.Receipt for the Order, using the order
+// number as the receipt's external ID.
+//
+// A receipt's total is the sum of its items, which must match
+// the transaction it is attached to. When the Order's Total
+// differs from the sum of its Items, because of a discount or a
+// charge the markup doesn't list, the difference is added as an
+// extra item.
+func (o *Order) Receipt() (*monzo.Receipt, error) {
+	if len(o.Items) == 0 {
+		return nil, fmt.Errorf("order %s has no items", o.OrderNumber)
+	}
+
+	r := monzo.MakeReceipt(o.OrderNumber)
+
+	for _, li := range o.Items {
+		item := monzo.MakeReceiptItemMoney(li.Name, li.Price)
+		item.Quantity(li.Quantity)
+		r.AddItem(item)
+	}
+
+	if sum := r.TotalMoney(); sum.Currency == o.Total.Currency && sum.Amount != o.Total.Amount {
+		diff := monzo.NewMoney(o.Total.Amount-sum.Amount, sum.Currency)
+
+		desc := "Other charges"
+		if diff.Amount < 0 {
+			desc = "Discounts"
+		}
+
+		r.AddItem(monzo.MakeReceiptItemMoney(desc, diff))
+	}
+
+	for _, t := range o.Taxes {
+		r.AddTax(monzo.Tax{
+			Description: t.Name,
+			Amount:      int(t.Amount.Amount),
+			Currency:    t.Amount.Currency,
+		})
+	}
+
+	if o.Merchant != "" {
+		r.SetMerchant(monzo.ReceiptMerchant{
+			Name:   o.Merchant,
+			Online: true,
+		})
+	}
+
+	return r, nil
+}
+
+// parseJSONLD finds every Order and Invoice in a JSON-LD
+// document, looking inside arrays and @graph. An Order that
+// can't be read is left out, and its error is returned in bad.
+func parseJSONLD(data []byte) (orders []*Order, bad []error, err error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case []interface{}:
+			for _, n := range node {
+				walk(n)
+			}
+		case map[string]interface{}:
+			var o *Order
+			var err error
+			switch {
+			case hasType(node, "Order"):
+				o, err = parseOrder(node)
+			case hasType(node, "Invoice"):
+				o, err = parseInvoice(node)
+			default:
+				walk(node["@graph"])
+				return
+			}
+
+			if err != nil {
+				bad = append(bad, err)
+				return
+			}
+			orders = append(orders, o)
+		}
+	}
+
+	walk(doc)
+	return orders, bad, nil
+}
+
+func parseOrder(node map[string]interface{}) (*Order, error) {
+	o := &Order{
+		OrderNumber: str(node["orderNumber"]),
+		Merchant:    name(first(node, "merchant", "seller", "broker")),
+		Date:        date(str(node["orderDate"])),
+	}
+
+	if o.OrderNumber == "" {
+		o.OrderNumber = str(node["identifier"])
+	}
+
+	for _, offer := range list(node["acceptedOffer"]) {
+		li, err := offerItem(offer)
+		if err != nil {
+			return nil, err
+		}
+		o.Items = append(o.Items, li)
+	}
+
+	for _, oi := range list(node["orderedItem"]) {
+		li, err := orderItem(oi)
+		if err != nil {
+			return nil, err
+		}
+		o.Items = append(o.Items, li)
+	}
+
+	taxes, err := taxes(node)
+	if err != nil {
+		return nil, err
+	}
+	o.Taxes = taxes
+
+	total, ok, err := amount(first(node, "totalPaymentDue", "totalPrice"))
+	if err == nil && !ok {
+		total, ok, err = price(node)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o, o.finish(total, ok)
+}
+
+func parseInvoice(node map[string]interface{}) (*Order, error) {
+	var o *Order
+
+	// The line items live on the Order the Invoice refers to,
+	// if there is one.
+	if ref, ok := node["referencesOrder"]; ok {
+		refs := list(ref)
+		if len(refs) > 0 {
+			var err error
+			if o, err = parseOrder(refs[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o == nil {
+		o = &Order{}
+	}
+
+	if n := str(first(node, "confirmationNumber", "identifier", "accountId")); n != "" && o.OrderNumber == "" {
+		o.OrderNumber = n
+	}
+
+	if m := name(first(node, "provider", "broker", "seller")); m != "" {
+		o.Merchant = m
+	}
+
+	if o.Date.IsZero() {
+		o.Date = date(str(first(node, "paymentDueDate", "paymentDue", "scheduledPaymentDate")))
+	}
+
+	total, ok, err := amount(first(node, "totalPaymentDue", "minimumPaymentDue"))
+	if err != nil {
+		return nil, err
+	}
+
+	return o, o.finish(total, ok)
+}
+
+// finish sets the Order's total, falling back to the sum of its
+// items, and checks the items share the total's currency.
+func (o *Order) finish(total monzo.Money, ok bool) error {
+	if ok {
+		o.Total = total
+		return nil
+	}
+
+	for i, li := range o.Items {
+		if i == 0 {
+			o.Total = monzo.NewMoney(0, li.Price.Currency)
+		}
+
+		sum, err := o.Total.Add(li.Price)
+		if err != nil {
+			return fmt.Errorf("order %s: %w", o.OrderNumber, err)
+		}
+		o.Total = sum
+	}
+
+	return nil
+}
+
+// offerItem reads a schema.org Offer, whose price is per unit.
+func offerItem(offer map[string]interface{}) (LineItem, error) {
+	li := LineItem{Name: name(offer["itemOffered"])}
+
+	if li.Name == "" {
+		li.Name = str(offer["name"])
+	}
+
+	q, err := quantity(offer["eligibleQuantity"])
+	if err != nil {
+		return LineItem{}, fmt.Errorf("item %q: %w", li.Name, err)
+	}
+	li.Quantity = q
+
+	unit, _, err := price(offer)
+	if err != nil {
+		return LineItem{}, err
+	}
+
+	li.Price = monzo.NewMoney(unit.Amount*int64(li.Quantity), unit.Currency)
+	return li, nil
+}
+
+// orderItem reads a schema.org OrderItem, which may carry its
+// own price or wrap a Product or Offer that does.
+func orderItem(oi map[string]interface{}) (LineItem, error) {
+	inner := object(oi["orderedItem"])
+	if inner == nil {
+		inner = oi
+	}
+
+	li, err := offerItem(inner)
+	if err != nil {
+		return LineItem{}, err
+	}
+
+	if li.Name == "" {
+		li.Name = name(inner)
+	}
+
+	if v, ok := oi["orderQuantity"]; ok {
+		q, err := quantity(v)
+		if err != nil {
+			return LineItem{}, fmt.Errorf("item %q: %w", li.Name, err)
+		}
+
+		per := li.Price.Amount / int64(li.Quantity)
+		li.Quantity = q
+		li.Price.Amount = per * int64(li.Quantity)
+	}
+
+	// Products put their price inside an offer.
+	if li.Price.Currency == "" {
+		if offers := list(inner["offers"]); len(offers) > 0 {
+			unit, _, err := price(offers[0])
+			if err != nil {
+				return LineItem{}, err
+			}
+			li.Price = monzo.NewMoney(unit.Amount*int64(li.Quantity), unit.Currency)
+		}
+	}
+
+	return li, nil
+}
+
+// taxes reads the taxes on an Order, given either as a tax
+// amount or as a price specification for tax.
+func taxes(node map[string]interface{}) ([]Tax, error) {
+	var out []Tax
+
+	if m, ok, err := amount(first(node, "totalTax", "tax")); err != nil {
+		return nil, err
+	} else if ok {
+		out = append(out, Tax{Name: "Tax", Amount: m})
+	}
+
+	for _, spec := range list(node["priceSpecification"]) {
+		if !hasType(spec, "TaxSpecification") && !isTax(str(spec["name"])) {
+			continue
+		}
+
+		m, ok, err := amount(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			n := str(spec["name"])
+			if n == "" {
+				n = "Tax"
+			}
+			out = append(out, Tax{Name: n, Amount: m})
+		}
+	}
+
+	return out, nil
+}
+
+// isTax reports whether a price specification's name says it is
+// for tax.
+func isTax(name string) bool {
+	name = strings.ToLower(name)
+	for _, t := range []string{"tax", "vat", "gst"} {
+		if strings.Contains(name, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// amount reads a MonetaryAmount, PriceSpecification or bare
+// price, reporting false if v doesn't hold one.
+func amount(v interface{}) (monzo.Money, bool, error) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		return price(node)
+	case []interface{}:
+		if len(node) > 0 {
+			return amount(node[0])
+		}
+	}
+
+	return monzo.Money{}, false, nil
+}
+
+// price reads the price and currency from a node, accepting
+// both the Offer and MonetaryAmount property names.
+func price(node map[string]interface{}) (monzo.Money, bool, error) {
+	p := str(first(node, "price", "value"))
+	c := str(first(node, "priceCurrency", "currency"))
+
+	if p == "" || c == "" {
+		return monzo.Money{}, false, nil
+	}
+
+	m, err := monzo.ParseMoney(p + " " + c)
+	if err != nil {
+		return monzo.Money{}, false, err
+	}
+
+	return m, true, nil
+}
+
+// hasType reports whether a node has the given schema.org type,
+// with or without the schema.org prefix.
+func hasType(node map[string]interface{}, want string) bool {
+	var types []interface{}
+	switch t := node["@type"].(type) {
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+
+	for _, t := range types {
+		s, _ := t.(string)
+		if s == want || strings.HasSuffix(s, "/"+want) || strings.HasSuffix(s, ":"+want) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// first returns the first of the keys that is set on node.
+func first(node map[string]interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		if v, ok := node[k]; ok && v != nil {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// list returns the objects in v, which may be a single object or
+// an array of them.
+func list(v interface{}) []map[string]interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{node}
+	case []interface{}:
+		var out []map[string]interface{}
+		for _, n := range node {
+			if m, ok := n.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
+
+func object(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// str returns v as a string, formatting numbers without
+// losing precision.
+func str(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return strings.TrimSpace(s)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+// name returns the name of an Organization, Product or similar,
+// which may also be given as a bare string.
+func name(v interface{}) string {
+	if m := object(v); m != nil {
+		return str(m["name"])
+	}
+
+	return str(v)
+}
+
+// quantity reads a quantity given as a number, a string or a
+// QuantitativeValue, which is one if it is missing. Anything
+// other than a whole number of at least one is an error, rather
+// than being rounded into a price that doesn't match the order.
+func quantity(v interface{}) (int, error) {
+	if m := object(v); m != nil {
+		v = m["value"]
+	}
+
+	s := str(v)
+	if s == "" {
+		return 1, nil
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 1 || n != math.Trunc(n) || n > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	return int(n), nil
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// date parses the date formats seen in order markup, returning
+// the zero Time if none match.
+func date(s string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,229 @@
+package orderimport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmus/monzo"
+	"github.com/tmus/monzo/monzotest"
+)
+
+const email = "From: Shop <orders@shop.example>\r\n" +
+	"To: someone@example.com\r\n" +
+	"Subject: Your order\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Thanks for your order.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><head><script type=3D\"application/ld+json\">{\"@context\": \"http://sc=\r\n" +
+	"hema.org\", \"@type\": \"Order\", \"orderNumber\": \"A-1001\", \"orderDate\": \"20=\r\n" +
+	"24-03-01T10:00:00Z\", \"merchant\": {\"@type\": \"Organization\", \"name\": \"Sh=\r\n" +
+	"op\"}, \"acceptedOffer\": [{\"@type\": \"Offer\", \"itemOffered\": {\"@type\": \"=\r\n" +
+	"Product\", \"name\": \"Mug\"}, \"price\": \"9.99\", \"priceCurrency\": \"GBP\", \"e=\r\n" +
+	"ligibleQuantity\": {\"value\": 2}}, {\"@type\": \"Offer\", \"itemOffered\": {\"n=\r\n" +
+	"ame\": \"Delivery\"}, \"price\": 6, \"priceCurrency\": \"GBP\"}], \"priceSpecifi=\r\n" +
+	"cation\": [{\"@type\": \"PriceSpecification\", \"name\": \"VAT\", \"price\": \"4.=\r\n" +
+	"33\", \"priceCurrency\": \"GBP\"}], \"totalPaymentDue\": {\"@type\": \"Monetary=\r\n" +
+	"Amount\", \"value\": \"25.98\", \"currency\": \"GBP\"}}</script></head></html>\r\n" +
+	"--b1--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	orders, err := ParseEmail(strings.NewReader(email))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(orders) != 1 {
+		t.Fatalf("expected 1 order, got %d", len(orders))
+	}
+
+	o := orders[0]
+	if o.OrderNumber != "A-1001" || o.Merchant != "Shop" || !o.Date.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected order %+v", o)
+	}
+
+	if len(o.Items) != 2 || o.Items[0].Quantity != 2 || o.Items[0].Price.Amount != 1998 || o.Items[1].Price.Amount != 600 {
+		t.Errorf("unexpected items %+v", o.Items)
+	}
+
+	if len(o.Taxes) != 1 || o.Taxes[0].Name != "VAT" || o.Taxes[0].Amount.Amount != 433 {
+		t.Errorf("unexpected taxes %+v", o.Taxes)
+	}
+
+	if o.Total != monzo.NewMoney(2598, monzo.CurrencyGBP) {
+		t.Errorf("unexpected total %v", o.Total)
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	doc := `<html><script type="application/ld+json">
+	{"@context": "https://schema.org", "@graph": [
+		{"@type": "WebPage"},
+		{"@type": "Invoice", "confirmationNumber": "INV-7", "provider": "Energy Co",
+		 "paymentDueDate": "2024-04-01",
+		 "referencesOrder": {"@type": "Order", "orderedItem": [
+			{"@type": "OrderItem", "orderQuantity": 3,
+			 "orderedItem": {"@type": "Product", "name": "Widget",
+			 "offers": {"@type": "Offer", "price": 1.5, "priceCurrency": "EUR"}}}
+		 ]}}
+	]}
+	</script></html>`
+
+	orders, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o := orders[0]
+	if o.OrderNumber != "INV-7" || o.Merchant != "Energy Co" || o.Date.IsZero() {
+		t.Errorf("unexpected invoice %+v", o)
+	}
+
+	if len(o.Items) != 1 || o.Items[0].Name != "Widget" || o.Items[0].Quantity != 3 || o.Items[0].Price.Amount != 450 {
+		t.Errorf("unexpected items %+v", o.Items)
+	}
+
+	if o.Total != monzo.NewMoney(450, monzo.CurrencyEUR) {
+		t.Errorf("expected the total to be summed from the items, got %v", o.Total)
+	}
+
+	if _, err := ParseHTML(strings.NewReader("<html></html>")); err != ErrNoOrder {
+		t.Errorf("expected ErrNoOrder, got %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	srv := monzotest.NewServer("token")
+	defer srv.Close()
+
+	ordered := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	seeded := srv.AddAccount(monzotest.Account{})
+	srv.AddTransaction(monzotest.Transaction{AccountID: seeded.ID, Amount: -2598, Created: ordered.Add(-48 * time.Hour)})
+	srv.AddTransaction(monzotest.Transaction{AccountID: seeded.ID, Amount: -1000, Created: ordered.Add(time.Hour)})
+	paid, _ := srv.AddTransaction(monzotest.Transaction{AccountID: seeded.ID, Amount: -2598, Created: ordered.Add(72 * time.Hour)})
+	srv.AddTransaction(monzotest.Transaction{AccountID: seeded.ID, Amount: -2598, Created: ordered.Add(96 * time.Hour)})
+
+	c := monzo.NewClient("token", monzo.WithBaseURL(srv.URL))
+	acc, _ := c.Account(seeded.ID)
+
+	proposals, err := Import(context.Background(), acc, strings.NewReader(email))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := proposals[0]
+	if !p.Matched() || p.Transaction.ID != paid.ID {
+		t.Fatalf("expected transaction %s to be proposed, got %+v", paid.ID, p.Transaction)
+	}
+
+	if err := p.Attach(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r, err := c.Receipt("A-1001")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if r.TransactionID != paid.ID || r.Total != 2598 || len(r.Items) != 2 || r.Merchant.Name != "Shop" {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+}
+
+func TestReceiptBalancesTotal(t *testing.T) {
+	o := &Order{
+		OrderNumber: "A-2",
+		Items: []LineItem{
+			{Name: "Mug", Quantity: 2, Price: monzo.NewMoney(1998, monzo.CurrencyGBP)},
+		},
+		Total: monzo.NewMoney(1798, monzo.CurrencyGBP),
+	}
+
+	r, err := o.Receipt()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if r.TotalMoney() != o.Total {
+		t.Errorf("expected the receipt to total %v, got %v", o.Total, r.TotalMoney())
+	}
+
+	if len(r.Items) != 2 || r.Items[1].Description() != "Discounts" || r.Items[1].Amount() != -200 {
+		t.Errorf("expected a discount item, got %+v", r.Items)
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	doc := `<html>
+	<script type="application/ld+json">{"@type": "Order", "orderNumber": </script>
+	<script type="application/ld+json">[
+		{"@type": "Order", "orderNumber": "A-3", "acceptedOffer": {"@type": "Offer", "itemOffered": {"name": "Pen"}, "price": "1.20", "priceCurrency": "GBP"}},
+		{"@type": "Order", "orderNumber": "A-4", "totalPrice": "5", "priceCurrency": "GBP"}
+	]</script>
+	</html>`
+
+	orders, err := ParseHTML(strings.NewReader(doc))
+
+	var skip *SkippedError
+	if !errors.As(err, &skip) || len(skip.Errs) != 1 {
+		t.Fatalf("expected one skipped script, got %v", err)
+	}
+
+	if len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(orders))
+	}
+
+	srv := monzotest.NewServer("token")
+	defer srv.Close()
+
+	seeded := srv.AddAccount(monzotest.Account{})
+	c := monzo.NewClient("token", monzo.WithBaseURL(srv.URL))
+	acc, _ := c.Account(seeded.ID)
+
+	proposals, err := Import(context.Background(), acc, strings.NewReader(doc))
+	if !errors.As(err, &skip) || len(skip.Errs) != 2 {
+		t.Fatalf("expected the script and the order without items to be skipped, got %v", err)
+	}
+
+	if len(proposals) != 1 || proposals[0].Order.OrderNumber != "A-3" {
+		t.Errorf("expected a proposal for A-3, got %+v", proposals)
+	}
+
+	if _, err := ParseHTML(strings.NewReader(`<script type="application/ld+json">{</script>`)); !errors.Is(err, ErrNoOrder) {
+		t.Errorf("expected ErrNoOrder, got %v", err)
+	}
+}
+
+func TestInvalidQuantity(t *testing.T) {
+	doc := `<script type="application/ld+json">[
+		{"@type": "Order", "orderNumber": "Q-1", "acceptedOffer": {"@type": "Offer", "itemOffered": {"name": "Cheese"}, "eligibleQuantity": {"value": 0.5}, "price": "4.00", "priceCurrency": "GBP"}},
+		{"@type": "Order", "orderNumber": "Q-2", "orderedItem": {"@type": "OrderItem", "orderQuantity": 0, "orderedItem": {"name": "Pen", "price": "1.20", "priceCurrency": "GBP"}}},
+		{"@type": "Order", "orderNumber": "Q-3", "orderedItem": {"@type": "OrderItem", "orderQuantity": "2", "orderedItem": {"name": "Pen", "price": "1.20", "priceCurrency": "GBP"}}}
+	]</script>`
+
+	orders, err := ParseHTML(strings.NewReader(doc))
+
+	var skip *SkippedError
+	if !errors.As(err, &skip) || len(skip.Errs) != 2 {
+		t.Fatalf("expected the orders with invalid quantities to be skipped, got %v", err)
+	}
+
+	if len(orders) != 1 || orders[0].OrderNumber != "Q-3" {
+		t.Fatalf("expected only Q-3, got %+v", orders)
+	}
+
+	if li := orders[0].Items[0]; li.Quantity != 2 || li.Price.Amount != 240 {
+		t.Errorf("expected 2 pens for 240, got %d for %d", li.Quantity, li.Price.Amount)
+	}
+}
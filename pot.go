@@ -1,9 +1,8 @@
 package monzo
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"net/http"
 )
 
 // Pot represents a Monzo pot.
@@ -11,22 +10,57 @@ type Pot struct {
 	ID       string
 	Name     string
 	Balance  int
-	Currency string
+	Currency Currency
 	Created  string
 	Updated  string
 	Deleted  bool
 }
 
+// PotResult is the outcome of running a Deposit or Withdrawal.
+type PotResult struct {
+	// Pot is the pot after the money was moved.
+	Pot Pot
+
+	// DedupeID is the dedupe ID that was sent.
+	DedupeID string
+
+	// Replayed reports whether the dedupe ID had already been
+	// run by a Client sharing the DedupeStore, in which case
+	// Monzo didn't move the money again. It is best-effort: it
+	// is always false without a DedupeStore, and a run whose
+	// response was lost, or that another Client is making at the
+	// same time, isn't seen. Monzo's dedupe is what stops the
+	// money moving twice.
+	Replayed bool
+}
+
+// Money returns the pot's balance as Money.
+func (p Pot) Money() Money {
+	return NewMoney(int64(p.Balance), p.Currency)
+}
+
 // AllPots retrieves all the users pots from the Monzo API,
 // even the ones that have been deleted.
 func (c *Client) AllPots() ([]Pot, error) {
-	return c.pots()
+	return c.pots(context.Background())
+}
+
+// AllPotsContext is like AllPots but uses the passed context
+// for the request.
+func (c *Client) AllPotsContext(ctx context.Context) ([]Pot, error) {
+	return c.pots(ctx)
 }
 
 // Pots returns a slice of Pots that belong to the user.
 // Only pots that haven't been deleted are returned.
 func (c *Client) Pots() ([]Pot, error) {
-	pots, err := c.pots()
+	return c.PotsContext(context.Background())
+}
+
+// PotsContext is like Pots but uses the passed context for
+// the request.
+func (c *Client) PotsContext(ctx context.Context) ([]Pot, error) {
+	pots, err := c.pots(ctx)
 	if err != nil {
 		return pots, err
 	}
@@ -43,7 +77,13 @@ func (c *Client) Pots() ([]Pot, error) {
 
 // Pot returns a single Pot from the Monzo API.
 func (c *Client) Pot(id string) (Pot, error) {
-	pots, err := c.pots()
+	return c.PotContext(context.Background(), id)
+}
+
+// PotContext is like Pot but uses the passed context for
+// the request.
+func (c *Client) PotContext(ctx context.Context, id string) (Pot, error) {
+	pots, err := c.pots(ctx)
 	if err != nil {
 		return Pot{}, err
 	}
@@ -57,29 +97,18 @@ func (c *Client) Pot(id string) (Pot, error) {
 		}
 	}
 
-	return Pot{}, fmt.Errorf("no pot found with ID %s", id)
+	return Pot{}, fmt.Errorf("no pot found with ID %s: %w", id, ErrNotFound)
 }
 
-func (c *Client) pots() ([]Pot, error) {
-	req, err := c.resourceRequest("pots")
+func (c *Client) pots(ctx context.Context) ([]Pot, error) {
+	req, err := c.resourceRequest(ctx, "pots")
 	if err != nil {
 		return nil, err
 	}
 
-	resp, _ := c.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch pots: %s", str)
-	}
-
-	bytes := b.Bytes()
 	var pots []Pot
-	if err := unwrapJSON(bytes, "pots", &pots); err != nil {
-		return nil, err
+	if err := c.send(req, "pots", &pots); err != nil {
+		return nil, fmt.Errorf("failed to fetch pots: %w", err)
 	}
 
 	return pots, nil
@@ -1,8 +1,11 @@
 package monzo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
 // Item represents a single line on a Receipt.
@@ -10,24 +13,81 @@ type Item struct {
 	description string
 	amount      int
 	currency    Currency
-	quantity    int
+	quantity    float64
 	unit        string
 
 	// subItems can only be nested one level deep.
 	//
 	// Monzo does not complain if a nested subItem is passed,
-	// but this should probably be checked at library-level.
-	// TODO: Prevent subItems being nested.
+	// so Receipt.Validate checks for it instead.
 	subItems []*Item
 }
 
 // Receipt represents a summary of spending against a transaction.
 type Receipt struct {
+	// ID is set by Monzo, and is only present on receipts
+	// fetched with Client.Receipt.
+	ID string
+
 	TransactionID string
 	ExternalID    string
 	Total         int
 	Currency      Currency
 	Items         []*Item
+	Taxes         []Tax
+	Payments      []Payment
+	Merchant      *ReceiptMerchant
+
+	// expected is the amount of the Transaction the Receipt is
+	// being saved against, if it is known.
+	expected *Money
+}
+
+// Tax is a tax charged on a Receipt, such as VAT.
+type Tax struct {
+	Description string   `json:"description"`
+	Amount      int      `json:"amount"`
+	Currency    Currency `json:"currency"`
+	TaxNumber   string   `json:"tax_number,omitempty"`
+}
+
+// PaymentType is the way a Receipt was paid for.
+type PaymentType string
+
+// The payment types supported by Monzo.
+const (
+	PaymentCard     PaymentType = "card"
+	PaymentCash     PaymentType = "cash"
+	PaymentGiftCard PaymentType = "gift_card"
+)
+
+// Payment is a single payment towards a Receipt. A receipt paid
+// partly by gift card and partly by card has two.
+type Payment struct {
+	Type     PaymentType `json:"type"`
+	Amount   int         `json:"amount"`
+	Currency Currency    `json:"currency"`
+
+	// The card details are only used for card payments.
+	LastFour string `json:"last_four,omitempty"`
+	AuthCode string `json:"auth_code,omitempty"`
+	AID      string `json:"aid,omitempty"`
+	MID      string `json:"mid,omitempty"`
+	TID      string `json:"tid,omitempty"`
+
+	// GiftCardType is only used for gift card payments.
+	GiftCardType string `json:"gift_card_type,omitempty"`
+}
+
+// ReceiptMerchant is the store a Receipt was issued by.
+type ReceiptMerchant struct {
+	Name          string `json:"name,omitempty"`
+	Online        bool   `json:"online"`
+	Phone         string `json:"phone,omitempty"`
+	Email         string `json:"email,omitempty"`
+	StoreName     string `json:"store_name,omitempty"`
+	StoreAddress  string `json:"store_address,omitempty"`
+	StorePostcode string `json:"store_postcode,omitempty"`
 }
 
 // MakeReceiptItem creates an Item representing a single line
@@ -42,6 +102,17 @@ func MakeReceiptItem(desc string, amount int, currency Currency) *Item {
 	}
 }
 
+// MakeReceiptItemMoney is like MakeReceiptItem but takes the
+// amount as Money.
+func MakeReceiptItemMoney(desc string, m Money) *Item {
+	return MakeReceiptItem(desc, int(m.Amount), m.Currency)
+}
+
+// Money returns the Item's amount as Money.
+func (i *Item) Money() Money {
+	return NewMoney(int64(i.amount), i.currency)
+}
+
 // AddSubItem adds a sub item to an existing Item. Monzo only
 // supports one level of nesting Items.
 func (i *Item) AddSubItem(subitem *Item) {
@@ -57,9 +128,46 @@ func (i *Item) Unit(unit string) {
 // Quantity adds a quantity to an Item. The default quantity
 // when creating an item is one.
 func (i *Item) Quantity(quant int) {
+	i.quantity = float64(quant)
+}
+
+// QuantityFloat adds a quantity that need not be whole to an
+// Item, such as 0.5 for an Item measured in "kg".
+func (i *Item) QuantityFloat(quant float64) {
 	i.quantity = quant
 }
 
+// Description returns the Item's description.
+func (i *Item) Description() string {
+	return i.description
+}
+
+// Amount returns the Item's amount in minor units.
+func (i *Item) Amount() int {
+	return i.amount
+}
+
+// Currency returns the Item's currency.
+func (i *Item) Currency() Currency {
+	return i.currency
+}
+
+// QuantityValue returns how many of the Item were bought, or
+// how much of it when it is measured in a unit such as "kg".
+func (i *Item) QuantityValue() float64 {
+	return i.quantity
+}
+
+// UnitValue returns the unit the Item's quantity is measured in.
+func (i *Item) UnitValue() string {
+	return i.unit
+}
+
+// SubItems returns the Items nested under the Item.
+func (i *Item) SubItems() []*Item {
+	return i.subItems
+}
+
 // MakeReceipt creates a Receipt to store against a Transaction.
 func MakeReceipt(externalID string) *Receipt {
 	return &Receipt{
@@ -72,6 +180,21 @@ func (r *Receipt) AddItem(is ...*Item) {
 	r.Items = append(r.Items, is...)
 }
 
+// AddTax adds a number of Taxes to a Receipt.
+func (r *Receipt) AddTax(ts ...Tax) {
+	r.Taxes = append(r.Taxes, ts...)
+}
+
+// AddPayment adds a number of Payments to a Receipt.
+func (r *Receipt) AddPayment(ps ...Payment) {
+	r.Payments = append(r.Payments, ps...)
+}
+
+// SetMerchant sets the store the Receipt was issued by.
+func (r *Receipt) SetMerchant(m ReceiptMerchant) {
+	r.Merchant = &m
+}
+
 // SetTransaction determines which Transaction the Receipt
 // should be saved against.
 func (r *Receipt) SetTransaction(transaction string) {
@@ -80,52 +203,82 @@ func (r *Receipt) SetTransaction(transaction string) {
 
 // MarshalJSON converts the Receipt into a format usable by
 // the Monzo API.
-func (r *Receipt) MarshalJSON() ([]byte, error) {
+func (r Receipt) MarshalJSON() ([]byte, error) {
 	if len(r.Items) == 0 {
 		return nil, fmt.Errorf("a receipt must contain at least one item")
 	}
 
-	r.calculateTotal()
-	r.determineCurrency()
+	// The total and currency are worked out from the Items
+	// rather than trusted from the Receipt, without changing
+	// the Receipt itself.
+	total := r.TotalMoney()
 
 	return json.Marshal(struct {
-		TransactionID string   `json:"transaction_id"`
-		ExternalID    string   `json:"external_id"`
-		Total         int      `json:"total"`
-		Currency      Currency `json:"currency"`
-		Items         []*Item  `json:"items"`
+		ID            string           `json:"id,omitempty"`
+		TransactionID string           `json:"transaction_id"`
+		ExternalID    string           `json:"external_id"`
+		Total         int              `json:"total"`
+		Currency      Currency         `json:"currency"`
+		Items         []*Item          `json:"items"`
+		Taxes         []Tax            `json:"taxes,omitempty"`
+		Payments      []Payment        `json:"payments,omitempty"`
+		Merchant      *ReceiptMerchant `json:"merchant,omitempty"`
 	}{
+		ID:            r.ID,
 		TransactionID: r.TransactionID,
 		ExternalID:    r.ExternalID,
-		Total:         r.Total,
-		Currency:      r.Currency,
+		Total:         int(total.Amount),
+		Currency:      total.Currency,
 		Items:         r.Items,
+		Taxes:         r.Taxes,
+		Payments:      r.Payments,
+		Merchant:      r.Merchant,
 	})
 }
 
-// calculateTotal saves the total cost of all receipt Items
-// in the Receipt's Total field.
-func (r *Receipt) calculateTotal() {
-	r.Total = 0
+// TotalMoney returns the total cost of the Receipt's Items as
+// Money. A receipt can only be for a single currency, so the
+// first Item's currency is used.
+func (r *Receipt) TotalMoney() Money {
+	if len(r.Items) == 0 {
+		return Money{}
+	}
 
+	var total int64
 	for _, item := range r.Items {
-		r.Total = r.Total + item.amount
+		total += int64(item.amount)
 	}
+
+	return NewMoney(total, r.Items[0].currency)
 }
 
-// determineCurrency sets the currency for the receipt. A receipt
-// can only be for a single currency, so just grab the first
-// item's currency and use that.
-func (r *Receipt) determineCurrency() {
-	r.Currency = r.Items[0].currency
+// UnmarshalJSON reads a Receipt in the format used by the Monzo
+// API, such as one produced by MarshalJSON.
+func (r *Receipt) UnmarshalJSON(data []byte) error {
+	var rj receiptJSON
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+
+	receipt, err := rj.receipt()
+	if err != nil {
+		return err
+	}
+
+	*r = *receipt
+	return nil
 }
 
 // MarshalJSON converts the Item into a json object that can
 // be read by the Monzo API.
-func (i *Item) MarshalJSON() ([]byte, error) {
+func (i Item) MarshalJSON() ([]byte, error) {
+	if !i.currency.Valid() {
+		return nil, fmt.Errorf("receipt item %q: %w: %q", i.description, ErrUnknownCurrency, i.currency)
+	}
+
 	return json.Marshal(struct {
 		Description string   `json:"description"`
-		Quantity    int      `json:"quantity"`
+		Quantity    float64  `json:"quantity"`
 		Unit        string   `json:"unit"`
 		Amount      int      `json:"amount"`
 		Currency    Currency `json:"currency"`
@@ -139,3 +292,273 @@ func (i *Item) MarshalJSON() ([]byte, error) {
 		SubItems:    i.subItems,
 	})
 }
+
+// receiptJSON is the shape of a receipt sent by Monzo.
+type receiptJSON struct {
+	ID            string           `json:"id"`
+	TransactionID string           `json:"transaction_id"`
+	ExternalID    string           `json:"external_id"`
+	Total         int              `json:"total"`
+	Currency      Currency         `json:"currency"`
+	Items         []itemJSON       `json:"items"`
+	Taxes         []Tax            `json:"taxes"`
+	Payments      []Payment        `json:"payments"`
+	Merchant      *ReceiptMerchant `json:"merchant"`
+}
+
+// itemJSON is the shape of a receipt item sent by Monzo.
+type itemJSON struct {
+	Description string     `json:"description"`
+	Quantity    float64    `json:"quantity"`
+	Unit        string     `json:"unit"`
+	Amount      int        `json:"amount"`
+	Currency    Currency   `json:"currency"`
+	SubItems    []itemJSON `json:"sub_items"`
+}
+
+// UnmarshalJSON reads an Item in the format used by the Monzo
+// API, such as one produced by MarshalJSON.
+func (i *Item) UnmarshalJSON(data []byte) error {
+	var ij itemJSON
+	if err := json.Unmarshal(data, &ij); err != nil {
+		return err
+	}
+
+	item, err := ij.item()
+	if err != nil {
+		return err
+	}
+
+	*i = *item
+	return nil
+}
+
+func (rj receiptJSON) receipt() (*Receipt, error) {
+	r := &Receipt{
+		ID:            rj.ID,
+		TransactionID: rj.TransactionID,
+		ExternalID:    rj.ExternalID,
+		Total:         rj.Total,
+		Currency:      rj.Currency,
+		Taxes:         rj.Taxes,
+		Payments:      rj.Payments,
+		Merchant:      rj.Merchant,
+	}
+
+	for _, ij := range rj.Items {
+		i, err := ij.item()
+		if err != nil {
+			return nil, err
+		}
+		r.Items = append(r.Items, i)
+	}
+
+	return r, nil
+}
+
+// item converts the wire format into an Item.
+func (ij itemJSON) item() (*Item, error) {
+	i := &Item{
+		description: ij.Description,
+		amount:      ij.Amount,
+		currency:    ij.Currency,
+		quantity:    ij.Quantity,
+		unit:        ij.Unit,
+	}
+
+	for _, sub := range ij.SubItems {
+		si, err := sub.item()
+		if err != nil {
+			return nil, err
+		}
+		i.subItems = append(i.subItems, si)
+	}
+
+	return i, nil
+}
+
+// Receipt fetches the receipt that was saved with the given
+// external ID.
+func (c *Client) Receipt(externalID string) (*Receipt, error) {
+	return c.ReceiptContext(context.Background(), externalID)
+}
+
+// ReceiptContext is like Receipt but uses the passed context
+// for the request.
+func (c *Client) ReceiptContext(ctx context.Context, externalID string) (*Receipt, error) {
+	req, err := c.resourceRequest(ctx, "transaction-receipts")
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("external_id", externalID)
+	req.URL.RawQuery = q.Encode()
+
+	var rj receiptJSON
+	if err := c.send(req, "receipt", &rj); err != nil {
+		return nil, fmt.Errorf("failed to fetch receipt: %w", err)
+	}
+
+	r, err := rj.receipt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch receipt: %w", err)
+	}
+
+	return r, nil
+}
+
+// DeleteReceipt deletes the receipt that was saved with the
+// given external ID.
+func (c *Client) DeleteReceipt(externalID string) error {
+	return c.DeleteReceiptContext(context.Background(), externalID)
+}
+
+// DeleteReceiptContext is like DeleteReceipt but uses the passed
+// context for the request.
+func (c *Client) DeleteReceiptContext(ctx context.Context, externalID string) error {
+	req, err := c.NewRequestContext(ctx, http.MethodDelete, "transaction-receipts", nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	q.Add("external_id", externalID)
+	req.URL.RawQuery = q.Encode()
+
+	if err := c.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to delete receipt: %w", err)
+	}
+
+	return nil
+}
+
+// ReceiptError is a single problem with a Receipt found by
+// Validate.
+type ReceiptError struct {
+	// Field is the path to the problem, such as "external_id"
+	// or "items[1].sub_items[0].quantity".
+	Field   string
+	Message string
+}
+
+func (e *ReceiptError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ReceiptErrors is returned by Validate, and lists every problem
+// found with a Receipt.
+type ReceiptErrors []*ReceiptError
+
+func (es ReceiptErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+
+	return "invalid receipt: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the Receipt for problems that Monzo either
+// rejects or silently accepts. It is run by AddReceipt before
+// anything is sent. If there are problems, the returned error
+// is ReceiptErrors.
+func (r *Receipt) Validate() error {
+	var errs ReceiptErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, &ReceiptError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if r.ExternalID == "" {
+		add("external_id", "must not be empty")
+	}
+
+	if len(r.Items) == 0 {
+		add("items", "must contain at least one item")
+	}
+
+	var currency Currency
+	if len(r.Items) > 0 {
+		currency = r.Items[0].currency
+	}
+
+	checkCurrency := func(field string, c Currency) {
+		switch {
+		case !c.Valid():
+			add(field, "unknown currency %q", c)
+		case c != currency:
+			add(field, "currency %s does not match the receipt currency %s", c, currency)
+		}
+	}
+
+	var checkItem func(field string, i *Item, depth int)
+	checkItem = func(field string, i *Item, depth int) {
+		if i.quantity <= 0 {
+			add(field+".quantity", "must be positive, got %v", i.quantity)
+		}
+
+		checkCurrency(field+".currency", i.currency)
+
+		if depth > 0 && len(i.subItems) > 0 {
+			add(field+".sub_items", "sub items can only be nested one level deep")
+		}
+
+		for n, sub := range i.subItems {
+			checkItem(fmt.Sprintf("%s.sub_items[%d]", field, n), sub, depth+1)
+		}
+	}
+
+	for n, i := range r.Items {
+		checkItem(fmt.Sprintf("items[%d]", n), i, 0)
+	}
+
+	for n, t := range r.Taxes {
+		checkCurrency(fmt.Sprintf("taxes[%d].currency", n), t.Currency)
+	}
+
+	for n, p := range r.Payments {
+		checkCurrency(fmt.Sprintf("payments[%d].currency", n), p.Currency)
+	}
+
+	if r.expected != nil && len(r.Items) > 0 {
+		total := r.TotalMoney()
+		if total != *r.expected {
+			add("total", "%s does not match the transaction amount of %s", total, r.expected)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// expectTransaction records the amount of the Transaction the
+// Receipt is being saved against, so that Validate can check
+// the total. Spending is negative on a Transaction but positive
+// on a Receipt, so the amount is made positive. The local amount
+// is used when the Receipt is in the currency the Transaction
+// was made in.
+func (r *Receipt) expectTransaction(t Transaction) {
+	r.expected = nil
+
+	m := t.Money()
+	if len(r.Items) > 0 && t.LocalCurrency != "" && r.Items[0].currency == t.LocalCurrency {
+		m = t.LocalMoney()
+	}
+
+	if m.Currency == "" || m.IsZero() {
+		return
+	}
+
+	if m.IsNegative() {
+		neg, err := m.Neg()
+		if err != nil {
+			return
+		}
+		m = neg
+	}
+
+	r.expected = &m
+}
@@ -0,0 +1,199 @@
+package monzo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the Client retries requests that fail
+// because of rate limiting, server errors or transport errors.
+//
+// Only idempotent requests are retried after a server or
+// transport error: GET, HEAD, OPTIONS, DELETE and PUT. Every PUT
+// this library sends carries a dedupe_id or an external_id, so
+// Monzo won't action it twice. PATCH requests, such as
+// Transaction.AddMetadata, are only retried when RetryPatch is
+// set. A 429 response means Monzo didn't action the request, so
+// it is retried whatever the method.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a request is
+	// sent, including the first. Values below 2 disable retries.
+	MaxAttempts int
+
+	// MinBackoff is the wait before the first retry. It doubles
+	// for every attempt after that, up to MaxBackoff, and is
+	// jittered so that clients don't retry in lockstep.
+	// MaxBackoff also caps the wait asked for by a Retry-After
+	// header.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// RetryPatch allows PATCH requests to be retried after a
+	// server or transport error.
+	RetryPatch bool
+
+	// OnRetry, if set, is called before the Client waits to
+	// retry a request.
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a retry that is about to happen.
+type RetryAttempt struct {
+	Request *http.Request
+
+	// Attempt is the number of the attempt about to be made,
+	// so the first retry is attempt 2.
+	Attempt int
+
+	// StatusCode is the status of the failed response, or zero
+	// if the request failed with Err before a response arrived.
+	StatusCode int
+	Err        error
+
+	// Wait is how long the Client will wait before retrying.
+	Wait time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy on the Client.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = p
+	}
+}
+
+// shouldRetry reports whether the outcome of sending req is
+// worth another attempt.
+func (p RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	// A request body can only be sent again if it can be
+	// recreated. http.NewRequest takes care of this for the
+	// body types used in this package.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+
+		return p.idempotent(req)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return p.idempotent(req)
+	}
+
+	return false
+}
+
+func (p RetryPolicy) idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPatch:
+		return p.RetryPatch
+	}
+
+	return false
+}
+
+// backoff returns how long to wait before the given attempt. A
+// Retry-After header on the failed response takes precedence,
+// though it is still capped at MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				wait = p.MaxBackoff
+			}
+			return wait
+		}
+	}
+
+	wait := p.MinBackoff
+	for i := 2; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if wait <= 0 {
+		return 0
+	}
+
+	// Wait for at least half of the backoff, with the rest
+	// chosen at random.
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+// retryAfter parses a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// rewind returns a copy of req with a fresh body, ready to be
+// sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.WithContext(req.Context())
+	if req.GetBody == nil {
+		return next, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	next.Body = body
+	return next, nil
+}
+
+// sleep waits for d, returning early with the context's error
+// if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
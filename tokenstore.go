@@ -0,0 +1,339 @@
+package monzo
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrNoToken is returned by a TokenStore that has nothing stored.
+var ErrNoToken = errors.New("no token stored")
+
+// TokenStore persists the Token used to authorize requests, so
+// that a refreshed token survives a restart. Monzo refresh
+// tokens can only be used once, so every refresh must be saved.
+type TokenStore interface {
+	// Load returns the stored Token, or ErrNoToken.
+	Load(ctx context.Context) (*Token, error)
+
+	// Save replaces the stored Token.
+	Save(ctx context.Context, t *Token) error
+
+	// Update replaces the stored Token with the one returned by
+	// fn, which is passed the current Token or nil. No other
+	// Update or Save can happen while fn runs, including from
+	// other processes sharing the store.
+	Update(ctx context.Context, fn func(*Token) (*Token, error)) error
+}
+
+// StoredTokenSource returns a TokenSource backed by store. Tokens
+// are refreshed inside store.Update, so processes sharing a store
+// never both spend the same refresh token: whichever gets there
+// second picks up the token the first one saved.
+func (o *OAuthConfig) StoredTokenSource(store TokenStore) TokenSource {
+	return &refreshingTokenSource{
+		conf:  o,
+		store: store,
+	}
+}
+
+// MemoryTokenStore keeps a Token in memory. It is what
+// OAuthConfig.TokenSource uses, and is lost when the process
+// exits.
+type MemoryTokenStore struct {
+	mu  sync.Mutex
+	tok *Token
+}
+
+// NewMemoryTokenStore creates a MemoryTokenStore holding t, which
+// may be nil.
+func NewMemoryTokenStore(t *Token) *MemoryTokenStore {
+	return &MemoryTokenStore{tok: t}
+}
+
+// Load returns the stored Token.
+func (s *MemoryTokenStore) Load(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok == nil {
+		return nil, ErrNoToken
+	}
+
+	return s.tok, nil
+}
+
+// Save replaces the stored Token.
+func (s *MemoryTokenStore) Save(ctx context.Context, t *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tok = t
+	return nil
+}
+
+// Update replaces the stored Token with the result of fn.
+func (s *MemoryTokenStore) Update(ctx context.Context, fn func(*Token) (*Token, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := fn(s.tok)
+	if err != nil {
+		return err
+	}
+
+	s.tok = t
+	return nil
+}
+
+// tokenFileMagic starts every file written by a FileTokenStore.
+var tokenFileMagic = []byte("MZTK\x01")
+
+const (
+	tokenSaltSize = 16
+
+	// pbkdf2Iterations is the work factor used to turn a
+	// passphrase into a key.
+	pbkdf2Iterations = 200000
+)
+
+// FileTokenStore keeps a Token in a file, encrypted with
+// AES-256-GCM. Writes are atomic, and a lock file next to the
+// token file stops processes sharing it from racing.
+type FileTokenStore struct {
+	path string
+
+	// deriveKey turns the salt stored in the file into the
+	// encryption key.
+	deriveKey func(salt []byte) []byte
+
+	// mu stops goroutines in this process polling the lock
+	// file against each other.
+	mu sync.Mutex
+}
+
+// NewFileTokenStore creates a FileTokenStore at path, encrypted
+// with key, which must be 32 bytes long.
+func NewFileTokenStore(path string, key []byte) (*FileTokenStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("token store key must be 32 bytes, got %d", len(key))
+	}
+
+	k := append([]byte(nil), key...)
+	return &FileTokenStore{
+		path:      path,
+		deriveKey: func([]byte) []byte { return k },
+	}, nil
+}
+
+// NewPassphraseFileTokenStore creates a FileTokenStore at path,
+// encrypted with a key derived from passphrase using PBKDF2.
+func NewPassphraseFileTokenStore(path string, passphrase string) *FileTokenStore {
+	var (
+		mu    sync.Mutex
+		salt  []byte
+		cache []byte
+	)
+
+	return &FileTokenStore{
+		path: path,
+		deriveKey: func(s []byte) []byte {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// Deriving the key is deliberately slow, so keep
+			// hold of it while the salt stays the same.
+			if cache == nil || !bytes.Equal(salt, s) {
+				salt = append([]byte(nil), s...)
+				cache = pbkdf2SHA256([]byte(passphrase), salt, pbkdf2Iterations, 32)
+			}
+
+			return cache
+		},
+	}
+}
+
+// ReadKeyFile reads a key for NewFileTokenStore from path. The
+// file holds either 32 raw bytes or 64 hex characters.
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 32 {
+		return b, nil
+	}
+
+	key, err := hex.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("key file %s must hold 32 bytes or 64 hex characters", path)
+	}
+
+	return key, nil
+}
+
+// Load decrypts and returns the stored Token.
+func (s *FileTokenStore) Load(ctx context.Context) (*Token, error) {
+	t, _, err := s.read()
+	return t, err
+}
+
+// Save encrypts t and replaces the stored Token with it.
+func (s *FileTokenStore) Save(ctx context.Context, t *Token) error {
+	return s.Update(ctx, func(*Token) (*Token, error) {
+		return t, nil
+	})
+}
+
+// Update replaces the stored Token with the result of fn while
+// holding the store's lock file.
+func (s *FileTokenStore) Update(ctx context.Context, fn func(*Token) (*Token, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockFile(ctx, s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cur, salt, err := s.read()
+	if err != nil && !errors.Is(err, ErrNoToken) {
+		return err
+	}
+
+	t, err := fn(cur)
+	if err != nil {
+		return err
+	}
+
+	return s.write(t, salt)
+}
+
+// read returns the stored Token and the salt it was written with.
+func (s *FileTokenStore) read() (*Token, []byte, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerSize := len(tokenFileMagic) + tokenSaltSize
+	if len(b) < headerSize || !bytes.Equal(b[:len(tokenFileMagic)], tokenFileMagic) {
+		return nil, nil, fmt.Errorf("%s is not a token file", s.path)
+	}
+
+	salt := b[len(tokenFileMagic):headerSize]
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rest := b[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, nil, fmt.Errorf("%s is truncated", s.path)
+	}
+
+	nonce, sealed := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, b[:headerSize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt %s: %w", s.path, err)
+	}
+
+	var t Token
+	if err := json.Unmarshal(plain, &t); err != nil {
+		return nil, nil, err
+	}
+
+	return &t, salt, nil
+}
+
+// write encrypts t and saves it. The existing salt is reused so
+// that a passphrase-derived key doesn't need deriving again.
+func (s *FileTokenStore) write(t *Token, salt []byte) error {
+	if salt == nil {
+		salt = make([]byte, tokenSaltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+	}
+
+	plain, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	header := append(append([]byte(nil), tokenFileMagic...), salt...)
+	out := append(append(header, nonce...), gcm.Seal(nil, nonce, plain, header)...)
+
+	return writeFileAtomic(s.path, out)
+}
+
+func (s *FileTokenStore) cipher(salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.deriveKey(salt))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 implements PBKDF2 from RFC 8018 with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+
+	return dk[:keyLen]
+}
@@ -2,6 +2,7 @@ package monzo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,94 +14,257 @@ import (
 
 // Transaction represents a single item on the Monzo feed.
 type Transaction struct {
-	ID       string
-	Amount   int
-	Currency Currency
+	ID        string   `json:"id"`
+	AccountID string   `json:"account_id"`
+	Amount    int      `json:"amount"`
+	Currency  Currency `json:"currency"`
+
+	// LocalAmount and LocalCurrency are what the transaction
+	// cost in the currency it was made in, which differs from
+	// Amount and Currency for card payments abroad.
+	LocalAmount   int      `json:"local_amount"`
+	LocalCurrency Currency `json:"local_currency"`
+
+	// AccountBalance is the balance of the account after the
+	// transaction.
+	AccountBalance int `json:"account_balance"`
+
+	Description string `json:"description"`
+	Notes       string `json:"notes"`
+
+	Created time.Time `json:"created"`
+
+	// Settled is the zero Time until the transaction settles.
+	Settled time.Time `json:"settled"`
+
+	DeclineReason string `json:"decline_reason"`
+	IsLoad        bool   `json:"is_load"`
+	Scheme        string `json:"scheme"`
+	DedupeID      string `json:"dedupe_id"`
+	Originator    bool   `json:"originator"`
+
+	// Category is the spending category of the transaction.
+	// If it has been split across several, Categories holds
+	// the amount in each.
+	Category   string         `json:"category"`
+	Categories map[string]int `json:"categories"`
+	Labels     []string       `json:"labels"`
+
+	IncludeInSpending          bool `json:"include_in_spending"`
+	AmountIsPending            bool `json:"amount_is_pending"`
+	CanBeExcludedFromBreakdown bool `json:"can_be_excluded_from_breakdown"`
+
+	Merchant     Merchant          `json:"merchant"`
+	Counterparty Counterparty      `json:"counterparty"`
+	Metadata     map[string]string `json:"metadata"`
+
+	// Attachments are the files that were attached to the
+	// Transaction when it was fetched.
+	Attachments []Attachment `json:"attachments"`
 
-	Description string
-	Notes       string
+	client *Client
+}
 
-	Created       time.Time
-	DeclineReason string
-	IsLoad        bool
-	Settled       time.Time
-	Category      string
-	// Merchant Merchant
-	Metadata interface{}
+// Counterparty is the other side of a bank transfer or a
+// payment between Monzo users.
+type Counterparty struct {
+	Name          string `json:"name"`
+	PreferredName string `json:"preferred_name"`
+	AccountNumber string `json:"account_number"`
+	SortCode      string `json:"sort_code"`
+	UserID        string `json:"user_id"`
+	AccountID     string `json:"account_id"`
+}
 
-	client *Client
+// potTransferScheme is the scheme of transactions that move
+// money in and out of pots.
+const potTransferScheme = "uk_retail_pot"
+
+// UnmarshalJSON decodes a transaction from the Monzo API, which
+// sends an empty string for Settled until the transaction
+// settles.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	// The alias type stops this method from being called again.
+	type transaction Transaction
+	var out struct {
+		transaction
+		Settled string `json:"settled"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+
+	*t = Transaction(out.transaction)
+
+	if out.Settled != "" {
+		settled, err := time.Parse(time.RFC3339Nano, out.Settled)
+		if err != nil {
+			return err
+		}
+		t.Settled = settled
+	}
+
+	return nil
+}
+
+// setClient gives the Transaction, and the Attachments on it,
+// the Client to make further calls with.
+func (t *Transaction) setClient(c *Client) {
+	t.client = c
+
+	for i := range t.Attachments {
+		t.Attachments[i].client = c
+	}
+}
+
+// Money returns the transaction's amount as Money.
+func (t Transaction) Money() Money {
+	return NewMoney(int64(t.Amount), t.Currency)
+}
+
+// LocalMoney returns the transaction's amount in the currency it
+// was made in as Money.
+func (t Transaction) LocalMoney() Money {
+	return NewMoney(int64(t.LocalAmount), t.LocalCurrency)
+}
+
+// IsPending reports whether the transaction has yet to settle,
+// or its amount may still change. Declined transactions are
+// never pending.
+func (t Transaction) IsPending() bool {
+	if t.IsDeclined() {
+		return false
+	}
+
+	return t.Settled.IsZero() || t.AmountIsPending
+}
+
+// IsDeclined reports whether the transaction was declined.
+func (t Transaction) IsDeclined() bool {
+	return t.DeclineReason != ""
+}
+
+// IsTopUp reports whether the transaction loaded money onto the
+// account from outside of Monzo.
+func (t Transaction) IsTopUp() bool {
+	return t.IsLoad && !t.IsPotTransfer()
+}
+
+// IsPotTransfer reports whether the transaction moved money
+// between the account and one of its pots.
+func (t Transaction) IsPotTransfer() bool {
+	return t.Scheme == potTransferScheme
 }
 
 // Transactions gets a number of transactions for an account.
 func (a Account) Transactions(limit int) ([]Transaction, error) {
+	return a.TransactionsContext(context.Background(), limit)
+}
+
+// TransactionsContext is like Transactions but uses the passed
+// context for the request.
+func (a Account) TransactionsContext(ctx context.Context, limit int) ([]Transaction, error) {
 	params := make(map[string]string)
 	params["limit"] = strconv.Itoa(limit)
-	return a.getTransactions(params)
+	return a.getTransactions(ctx, params)
 }
 
 // Transaction returns a single transaction for an account.
 func (a Account) Transaction(id string) (Transaction, error) {
-	req, err := a.client.resourceRequest("transactions/" + id)
+	return a.TransactionContext(context.Background(), id)
+}
+
+// TransactionContext is like Transaction but uses the passed
+// context for the request.
+func (a Account) TransactionContext(ctx context.Context, id string) (Transaction, error) {
+	return a.client.transaction(ctx, id)
+}
+
+func (c *Client) transaction(ctx context.Context, id string) (Transaction, error) {
+	req, err := c.resourceRequest(ctx, "transactions/"+id)
 	if err != nil {
 		return Transaction{}, err
 	}
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return Transaction{}, fmt.Errorf("failed to fetch transaction: %s", str)
-	}
+	q := req.URL.Query()
+	q.Add("expand[]", "merchant")
+	req.URL.RawQuery = q.Encode()
 
-	bytes := b.Bytes()
 	var transaction Transaction
-	if err := unwrapJSON(bytes, "transaction", &transaction); err != nil {
-		return Transaction{}, err
+	if err := c.send(req, "transaction", &transaction); err != nil {
+		return Transaction{}, fmt.Errorf("failed to fetch transaction: %w", err)
 	}
 
-	transaction.client = a.client
+	transaction.setClient(c)
 
 	return transaction, nil
 }
 
 // TransactionsSince returns the transactions that have occured since a given Time.
 func (a Account) TransactionsSince(ts time.Time, limit int) ([]Transaction, error) {
+	return a.TransactionsSinceContext(context.Background(), ts, limit)
+}
+
+// TransactionsSinceContext is like TransactionsSince but uses
+// the passed context for the request.
+func (a Account) TransactionsSinceContext(ctx context.Context, ts time.Time, limit int) ([]Transaction, error) {
 	params := make(map[string]string)
 	params["limit"] = strconv.Itoa(limit)
 	params["since"] = ts.Format(time.RFC3339)
 
-	return a.getTransactions(params)
+	return a.getTransactions(ctx, params)
 }
 
 // TransactionsBefore returns the transactions that occured before a given Time.
 func (a Account) TransactionsBefore(ts time.Time, limit int) ([]Transaction, error) {
+	return a.TransactionsBeforeContext(context.Background(), ts, limit)
+}
+
+// TransactionsBeforeContext is like TransactionsBefore but uses
+// the passed context for the request.
+func (a Account) TransactionsBeforeContext(ctx context.Context, ts time.Time, limit int) ([]Transaction, error) {
 	params := make(map[string]string)
 	params["limit"] = strconv.Itoa(limit)
 	params["before"] = ts.Format(time.RFC3339)
 
-	return a.getTransactions(params)
+	return a.getTransactions(ctx, params)
 }
 
 // TransactionsBetween returns the transactions that happened between two Times.
+// Every page of transactions is fetched, however many there are.
 func (a Account) TransactionsBetween(since time.Time, before time.Time) ([]Transaction, error) {
-	params := make(map[string]string)
-	params["since"] = since.Format(time.RFC3339)
-	params["before"] = before.Format(time.RFC3339)
+	return a.TransactionsBetweenContext(context.Background(), since, before)
+}
+
+// TransactionsBetweenContext is like TransactionsBetween but
+// uses the passed context for the request.
+func (a Account) TransactionsBetweenContext(ctx context.Context, since time.Time, before time.Time) ([]Transaction, error) {
+	it := a.TransactionIterator(TransactionQuery{
+		Since:  since,
+		Before: before,
+	})
+
+	var transactions []Transaction
+	for it.Next(ctx) {
+		transactions = append(transactions, it.Transaction())
+	}
 
-	return a.getTransactions(params)
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
 }
 
-func (a Account) getTransactions(params map[string]string) ([]Transaction, error) {
-	req, err := a.client.resourceRequest("transactions")
+func (a Account) getTransactions(ctx context.Context, params map[string]string) ([]Transaction, error) {
+	req, err := a.client.resourceRequest(ctx, "transactions")
 	if err != nil {
 		return nil, err
 	}
 
 	q := req.URL.Query()
 	q.Add("account_id", a.ID)
+	q.Add("expand[]", "merchant")
 
 	for param, value := range params {
 		q.Add(param, value)
@@ -108,24 +272,13 @@ func (a Account) getTransactions(params map[string]string) ([]Transaction, error
 
 	req.URL.RawQuery = q.Encode()
 
-	resp, _ := a.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch transactions: %s", str)
-	}
-
-	bytes := b.Bytes()
 	var transactions []Transaction
-	if err := unwrapJSON(bytes, "transactions", &transactions); err != nil {
-		return nil, err
+	if err := a.client.send(req, "transactions", &transactions); err != nil {
+		return nil, fmt.Errorf("failed to fetch transactions: %w", err)
 	}
 
-	for _, tx := range transactions {
-		tx.client = a.client
+	for i := range transactions {
+		transactions[i].setClient(a.client)
 	}
 
 	return transactions, nil
@@ -133,15 +286,27 @@ func (a Account) getTransactions(params map[string]string) ([]Transaction, error
 
 // Note stores a string against the Transaction.
 func (t Transaction) Note(note string) error {
+	return t.NoteContext(context.Background(), note)
+}
+
+// NoteContext is like Note but uses the passed context for
+// the request.
+func (t Transaction) NoteContext(ctx context.Context, note string) error {
 	data := make(map[string]string)
 	data["notes"] = note
-	return t.AddMetadata(data)
+	return t.AddMetadataContext(ctx, data)
 }
 
 // AddMetadata saves Metadata against a Transaction.
 //
 // Currently this is not visible in the Monzo App.
 func (t Transaction) AddMetadata(meta map[string]string) error {
+	return t.AddMetadataContext(context.Background(), meta)
+}
+
+// AddMetadataContext is like AddMetadata but uses the passed
+// context for the request.
+func (t Transaction) AddMetadataContext(ctx context.Context, meta map[string]string) error {
 	endpoint := "/transactions/" + t.ID
 
 	data := url.Values{}
@@ -150,36 +315,48 @@ func (t Transaction) AddMetadata(meta map[string]string) error {
 		data.Add("metadata["+key+"]", value)
 	}
 
-	req, err := t.client.NewRequest(http.MethodPatch, endpoint, strings.NewReader(data.Encode()))
+	req, err := t.client.NewRequestContext(ctx, http.MethodPatch, endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, _ := t.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to add metadata: %s", str)
+	if err := t.client.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to add metadata: %w", err)
 	}
 
 	return nil
 }
 
 // AddReceipt saves the given Receipt against the Transaction.
+// The Receipt is checked with Validate first, including that
+// its total matches the Transaction's amount. The passed Receipt
+// is left unchanged.
 func (t Transaction) AddReceipt(r *Receipt) error {
-	r.SetTransaction(t.ID)
+	return t.AddReceiptContext(context.Background(), r)
+}
 
-	data, err := json.Marshal(r)
+// AddReceiptContext is like AddReceipt but uses the passed
+// context for the request.
+func (t Transaction) AddReceiptContext(ctx context.Context, r *Receipt) error {
+	// The checks are made on a copy, so that the caller's
+	// Receipt can be reused for another Transaction.
+	rc := *r
+	rc.SetTransaction(t.ID)
+	rc.expectTransaction(t)
+
+	if err := rc.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&rc)
 	if err != nil {
 		return err
 	}
 
-	req, err := t.client.NewRequest(
+	req, err := t.client.NewRequestContext(
+		ctx,
 		http.MethodPut,
 		"/transaction-receipts",
 		bytes.NewBuffer(data),
@@ -190,14 +367,8 @@ func (t Transaction) AddReceipt(r *Receipt) error {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, _ := t.client.Do(req)
-
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to add receipt: %s", str)
+	if err := t.client.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to add receipt: %w", err)
 	}
 
 	return nil
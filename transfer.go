@@ -0,0 +1,517 @@
+package monzo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoTransfer is returned by a TransferStore that has no
+// PotTransfer with the given ID.
+var ErrNoTransfer = errors.New("no transfer stored")
+
+// TransferStatus is how far a PotTransfer has got.
+type TransferStatus string
+
+// The states a PotTransfer moves through. Completed, RolledBack
+// and Failed are final.
+const (
+	// TransferPending has not yet taken the money out of the
+	// source pot.
+	TransferPending TransferStatus = "pending"
+
+	// TransferWithdrawn has taken the money out of the source
+	// pot, so it is in the account, and not yet put it in the
+	// destination pot.
+	TransferWithdrawn TransferStatus = "withdrawn"
+
+	// TransferRollingBack couldn't put the money in the
+	// destination pot, and is putting it back in the source pot.
+	TransferRollingBack TransferStatus = "rolling_back"
+
+	// TransferCompleted has moved the money into the destination
+	// pot.
+	TransferCompleted TransferStatus = "completed"
+
+	// TransferRolledBack has put the money back in the source
+	// pot.
+	TransferRolledBack TransferStatus = "rolled_back"
+
+	// TransferFailed couldn't take the money out of the source
+	// pot, so nothing moved.
+	TransferFailed TransferStatus = "failed"
+
+	// TransferStranded couldn't put the money in either pot, so
+	// it has been left in the account. It isn't final: resuming
+	// the transfer tries again to put the money back in the
+	// source pot.
+	TransferStranded TransferStatus = "stranded"
+)
+
+// Final reports whether the transfer has finished, one way or
+// another.
+func (s TransferStatus) Final() bool {
+	switch s {
+	case TransferCompleted, TransferRolledBack, TransferFailed:
+		return true
+	}
+
+	return false
+}
+
+// PotTransfer moves money from one pot to another. Monzo can't
+// do this directly, so the money is withdrawn into an account and
+// then deposited. Its state is saved after each step, so that a
+// transfer interrupted by a crash can be finished with
+// ResumeTransfer.
+type PotTransfer struct {
+	ID        string         `json:"id"`
+	AccountID string         `json:"account_id"`
+	FromPotID string         `json:"from_pot_id"`
+	ToPotID   string         `json:"to_pot_id"`
+	Amount    int            `json:"amount"`
+	Currency  Currency       `json:"currency"`
+	Status    TransferStatus `json:"status"`
+
+	// Error describes why the last attempt at a step failed, if
+	// it did.
+	Error string `json:"error,omitempty"`
+
+	// Reason is why Monzo rejected the step that stopped the
+	// transfer from completing.
+	Reason string `json:"reason,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// dedupeID returns the dedupe ID for a step of the transfer,
+// which is the same however many times the step is tried.
+func (t *PotTransfer) dedupeID(step string) string {
+	sum := sha256.Sum256([]byte("transfer:" + t.ID + ":" + step))
+	return hex.EncodeToString(sum[:16])
+}
+
+// TransferStore saves the state of PotTransfers.
+type TransferStore interface {
+	// Load returns the PotTransfer with the given ID, or
+	// ErrNoTransfer.
+	Load(ctx context.Context, id string) (*PotTransfer, error)
+
+	// Save replaces the stored state of the PotTransfer.
+	Save(ctx context.Context, t *PotTransfer) error
+
+	// List returns every stored PotTransfer, oldest first, so
+	// that unfinished ones can be resumed.
+	List(ctx context.Context) ([]*PotTransfer, error)
+}
+
+// WithTransferStore saves the state of pot transfers in store.
+// By default it is kept in memory, so a transfer can't be
+// resumed after a crash.
+func WithTransferStore(store TransferStore) Option {
+	return func(c *Client) {
+		c.transfers = store
+	}
+}
+
+// TransferOption configures TransferBetweenPots.
+type TransferOption func(*transferConfig)
+
+type transferConfig struct {
+	id       string
+	attempts int
+}
+
+// WithTransferID sets the transfer's ID. Calling
+// TransferBetweenPots again with the same ID resumes the
+// transfer rather than starting another. By default a random ID
+// is used.
+func WithTransferID(id string) TransferOption {
+	return func(c *transferConfig) {
+		c.id = id
+	}
+}
+
+// WithTransferAttempts sets how many times each step is tried
+// before giving up. It defaults to 3. The Client's RetryPolicy
+// isn't used for these requests, so each attempt sends the
+// request once.
+func WithTransferAttempts(n int) TransferOption {
+	return func(c *transferConfig) {
+		if n > 0 {
+			c.attempts = n
+		}
+	}
+}
+
+// TransferBetweenPots moves amount from one pot to another by
+// withdrawing it into via and depositing it again.
+//
+// Each step is retried with the same dedupe ID, so Monzo never
+// moves the money twice. If the deposit is rejected, the money is
+// put back in the source pot. If a step fails without a clear
+// answer from Monzo, such as a timeout, the transfer is left
+// unfinished and the error returned; it can be finished later
+// with ResumeTransfer.
+//
+// The PotTransfer is returned whenever it has been created, even
+// with an error, so that its Status can be checked.
+func (c *Client) TransferBetweenPots(from, to Pot, amount int, via Account, opts ...TransferOption) (*PotTransfer, error) {
+	return c.TransferBetweenPotsContext(context.Background(), from, to, amount, via, opts...)
+}
+
+// TransferBetweenPotsContext is like TransferBetweenPots but uses
+// the passed context for the requests.
+func (c *Client) TransferBetweenPotsContext(ctx context.Context, from, to Pot, amount int, via Account, opts ...TransferOption) (*PotTransfer, error) {
+	conf := transferConfig{attempts: 3}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if amount <= 0 {
+		return nil, fmt.Errorf("cannot transfer %d between pots: amount must be positive", amount)
+	}
+
+	if from.ID == to.ID {
+		return nil, errors.New("cannot transfer between a pot and itself")
+	}
+
+	if from.Currency != "" && to.Currency != "" && from.Currency != to.Currency {
+		return nil, fmt.Errorf("cannot transfer from a %s pot to a %s pot: %w", from.Currency, to.Currency, ErrCurrencyMismatch)
+	}
+
+	store := c.transferStore()
+
+	if conf.id == "" {
+		id, err := randomDedupeID()
+		if err != nil {
+			return nil, err
+		}
+		conf.id = id
+	}
+
+	t, err := store.Load(ctx, conf.id)
+	if err == nil {
+		if t.FromPotID != from.ID || t.ToPotID != to.ID || t.Amount != amount || t.AccountID != via.ID {
+			return t, fmt.Errorf("transfer %s already exists with different details", t.ID)
+		}
+
+		return t, c.runTransfer(ctx, store, t, conf)
+	}
+
+	if !errors.Is(err, ErrNoTransfer) {
+		return nil, fmt.Errorf("failed to load transfer: %w", err)
+	}
+
+	now := time.Now()
+	t = &PotTransfer{
+		ID:        conf.id,
+		AccountID: via.ID,
+		FromPotID: from.ID,
+		ToPotID:   to.ID,
+		Amount:    amount,
+		Currency:  from.Currency,
+		Status:    TransferPending,
+		Created:   now,
+		Updated:   now,
+	}
+
+	if err := store.Save(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to save transfer: %w", err)
+	}
+
+	return t, c.runTransfer(ctx, store, t, conf)
+}
+
+// ResumeTransfer finishes a PotTransfer that was interrupted,
+// carrying on from the last step that was saved. A stranded
+// transfer tries again to put the money back in the source pot.
+// Finished transfers are returned as they are.
+func (c *Client) ResumeTransfer(id string, opts ...TransferOption) (*PotTransfer, error) {
+	return c.ResumeTransferContext(context.Background(), id, opts...)
+}
+
+// ResumeTransferContext is like ResumeTransfer but uses the
+// passed context for the requests.
+func (c *Client) ResumeTransferContext(ctx context.Context, id string, opts ...TransferOption) (*PotTransfer, error) {
+	conf := transferConfig{attempts: 3}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	store := c.transferStore()
+
+	t, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transfer: %w", err)
+	}
+
+	return t, c.runTransfer(ctx, store, t, conf)
+}
+
+// transferStore returns the Client's TransferStore, falling back
+// to one in memory for Clients not made with NewClient.
+func (c *Client) transferStore() TransferStore {
+	if c.transfers == nil {
+		return NewMemoryTransferStore()
+	}
+
+	return c.transfers
+}
+
+// runTransfer takes t through its remaining steps, saving its
+// state in store after each one. It stops if the transfer is
+// stranded, rather than trying the rollback again straight away.
+func (c *Client) runTransfer(ctx context.Context, store TransferStore, t *PotTransfer, conf transferConfig) error {
+	// transferStep does the retrying, so the requests are sent
+	// once per attempt rather than once per retry of each.
+	acc := Account{ID: t.AccountID, client: c.withoutRetries()}
+	from := Pot{ID: t.FromPotID, Currency: t.Currency}
+	to := Pot{ID: t.ToPotID, Currency: t.Currency}
+
+	for !t.Status.Final() {
+		var err error
+		var next, fallback TransferStatus
+
+		switch t.Status {
+		case TransferPending:
+			next, fallback = TransferWithdrawn, TransferFailed
+			err = c.transferStep(ctx, conf, func() error {
+				w, err := acc.WithdrawContext(ctx, from, t.Amount, WithDedupeID(t.dedupeID("withdraw")))
+				if err != nil {
+					return err
+				}
+				_, err = w.RunContext(ctx)
+				return err
+			})
+		case TransferWithdrawn:
+			next, fallback = TransferCompleted, TransferRollingBack
+			err = c.transferStep(ctx, conf, func() error {
+				return depositOnce(ctx, acc, to, t.Amount, t.dedupeID("deposit"))
+			})
+		case TransferRollingBack, TransferStranded:
+			next, fallback = TransferRolledBack, TransferStranded
+			err = c.transferStep(ctx, conf, func() error {
+				return depositOnce(ctx, acc, from, t.Amount, t.dedupeID("rollback"))
+			})
+		default:
+			return fmt.Errorf("transfer %s has unknown status %q", t.ID, t.Status)
+		}
+
+		switch {
+		case err == nil:
+			t.Status = next
+			t.Error = ""
+		case rejected(err):
+			t.Status = fallback
+			t.Error = err.Error()
+			t.Reason = reason(err)
+		default:
+			// Monzo may or may not have made the step, so it
+			// is left to be tried again with the same dedupe ID.
+			t.Error = err.Error()
+		}
+
+		t.Updated = time.Now()
+		if serr := store.Save(ctx, t); serr != nil {
+			return fmt.Errorf("failed to save transfer: %w", serr)
+		}
+
+		if err != nil && !rejected(err) {
+			return fmt.Errorf("transfer %s is unfinished: %w", t.ID, err)
+		}
+
+		if t.Status == TransferStranded {
+			break
+		}
+	}
+
+	if t.Status != TransferCompleted {
+		return fmt.Errorf("transfer %s %s: %s", t.ID, t.Status, t.Reason)
+	}
+
+	return nil
+}
+
+func depositOnce(ctx context.Context, acc Account, p Pot, amount int, id string) error {
+	d, err := acc.DepositContext(ctx, p, amount, WithDedupeID(id))
+	if err != nil {
+		return err
+	}
+
+	_, err = d.RunContext(ctx)
+	return err
+}
+
+// transferStep tries fn up to the configured number of times,
+// stopping early if Monzo rejects it outright.
+func (c *Client) transferStep(ctx context.Context, conf transferConfig, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= conf.attempts; attempt++ {
+		if err = fn(); err == nil || rejected(err) {
+			return err
+		}
+
+		if attempt < conf.attempts {
+			if serr := sleep(ctx, c.retryPolicy.backoff(attempt+1, nil)); serr != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
+
+// withoutRetries returns a copy of the Client that sends each
+// request once.
+func (c *Client) withoutRetries() *Client {
+	once := *c
+	once.retryPolicy.MaxAttempts = 1
+	return &once
+}
+
+// rejected reports whether err is Monzo turning a request down
+// for good, as opposed to a failure that leaves it unclear
+// whether the request was carried out, or one that may succeed
+// later, such as a 401 that new credentials would fix.
+func rejected(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+
+	return false
+}
+
+// reason describes why Monzo rejected a step, in Monzo's own
+// words, rather than with the whole error.
+func reason(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code == "" {
+		return err.Error()
+	}
+
+	if apiErr.Message == "" {
+		return apiErr.Code
+	}
+
+	return apiErr.Code + ": " + apiErr.Message
+}
+
+// MemoryTransferStore keeps PotTransfers in memory. They are lost
+// when the process exits.
+type MemoryTransferStore struct {
+	mu        sync.Mutex
+	transfers map[string]PotTransfer
+}
+
+// NewMemoryTransferStore creates an empty MemoryTransferStore.
+func NewMemoryTransferStore() *MemoryTransferStore {
+	return &MemoryTransferStore{transfers: make(map[string]PotTransfer)}
+}
+
+// Load returns the PotTransfer with the given ID.
+func (s *MemoryTransferStore) Load(ctx context.Context, id string) (*PotTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.transfers[id]
+	if !ok {
+		return nil, ErrNoTransfer
+	}
+
+	return &t, nil
+}
+
+// Save replaces the stored state of the PotTransfer.
+func (s *MemoryTransferStore) Save(ctx context.Context, t *PotTransfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transfers[t.ID] = *t
+	return nil
+}
+
+// List returns every stored PotTransfer.
+func (s *MemoryTransferStore) List(ctx context.Context) ([]*PotTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfers := make([]*PotTransfer, 0, len(s.transfers))
+	for _, t := range s.transfers {
+		t := t
+		transfers = append(transfers, &t)
+	}
+
+	sortTransfers(transfers)
+	return transfers, nil
+}
+
+// FileTransferStore keeps PotTransfers in a JSON file. Like a
+// FileDedupeStore, the file can be shared between processes.
+type FileTransferStore struct {
+	path string
+}
+
+// NewFileTransferStore creates a FileTransferStore that keeps its
+// transfers at path.
+func NewFileTransferStore(path string) *FileTransferStore {
+	return &FileTransferStore{path: path}
+}
+
+// Load returns the PotTransfer with the given ID.
+func (s *FileTransferStore) Load(ctx context.Context, id string) (*PotTransfer, error) {
+	transfers := make(map[string]*PotTransfer)
+	if err := readJSONFile(s.path, &transfers); err != nil {
+		return nil, err
+	}
+
+	t, ok := transfers[id]
+	if !ok {
+		return nil, ErrNoTransfer
+	}
+
+	return t, nil
+}
+
+// Save replaces the stored state of the PotTransfer.
+func (s *FileTransferStore) Save(ctx context.Context, t *PotTransfer) error {
+	transfers := make(map[string]*PotTransfer)
+	return updateJSONFile(ctx, s.path, &transfers, func() {
+		transfers[t.ID] = t
+	})
+}
+
+// List returns every stored PotTransfer.
+func (s *FileTransferStore) List(ctx context.Context) ([]*PotTransfer, error) {
+	transfers := make(map[string]*PotTransfer)
+	if err := readJSONFile(s.path, &transfers); err != nil {
+		return nil, err
+	}
+
+	list := make([]*PotTransfer, 0, len(transfers))
+	for _, t := range transfers {
+		list = append(list, t)
+	}
+
+	sortTransfers(list)
+	return list, nil
+}
+
+func sortTransfers(transfers []*PotTransfer) {
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].Created.Before(transfers[j].Created)
+	})
+}
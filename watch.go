@@ -0,0 +1,362 @@
+package monzo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoWatchState is returned by a WatchStore that has nothing
+// stored.
+var ErrNoWatchState = errors.New("no watch state stored")
+
+// WatchState is what Account.Watch remembers between polls: how
+// far it has got, and the transactions that may still change.
+type WatchState struct {
+	// HighWater is when the newest transaction seen was created.
+	HighWater time.Time `json:"high_water"`
+
+	// Transactions holds the last known state of the recent
+	// transactions, by ID.
+	Transactions map[string]WatchedTransaction `json:"transactions"`
+}
+
+// WatchedTransaction is the last known state of a transaction,
+// which is compared against to find what has changed.
+type WatchedTransaction struct {
+	Created  time.Time `json:"created"`
+	Amount   int       `json:"amount"`
+	Notes    string    `json:"notes"`
+	Settled  bool      `json:"settled"`
+	Declined bool      `json:"declined"`
+}
+
+func watched(t Transaction) WatchedTransaction {
+	return WatchedTransaction{
+		Created:  t.Created,
+		Amount:   t.Amount,
+		Notes:    t.Notes,
+		Settled:  !t.IsPending(),
+		Declined: t.IsDeclined(),
+	}
+}
+
+// WatchStore persists a WatchState, so that a watcher carries on
+// where it left off after a restart.
+type WatchStore interface {
+	// Load returns the stored WatchState, or ErrNoWatchState.
+	Load(ctx context.Context) (*WatchState, error)
+
+	// Save replaces the stored WatchState.
+	Save(ctx context.Context, s *WatchState) error
+}
+
+// MemoryWatchStore keeps a WatchState in memory. It is what
+// Account.Watch uses by default, and is lost when the process
+// exits.
+type MemoryWatchStore struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+// Load returns the stored WatchState.
+func (s *MemoryWatchStore) Load(ctx context.Context) (*WatchState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return nil, ErrNoWatchState
+	}
+
+	var ws WatchState
+	if err := json.Unmarshal(s.state, &ws); err != nil {
+		return nil, err
+	}
+
+	return &ws, nil
+}
+
+// Save replaces the stored WatchState.
+func (s *MemoryWatchStore) Save(ctx context.Context, ws *WatchState) error {
+	data, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = data
+	return nil
+}
+
+// FileWatchStore keeps a WatchState in a JSON file. The file is
+// replaced atomically, so a crash never leaves it half written.
+type FileWatchStore struct {
+	path string
+}
+
+// NewFileWatchStore creates a FileWatchStore that keeps its state
+// at path.
+func NewFileWatchStore(path string) *FileWatchStore {
+	return &FileWatchStore{path: path}
+}
+
+// Load reads the WatchState from the file.
+func (s *FileWatchStore) Load(ctx context.Context) (*WatchState, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoWatchState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch state: %w", err)
+	}
+
+	var ws WatchState
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("failed to read watch state: %w", err)
+	}
+
+	return &ws, nil
+}
+
+// Save writes the WatchState to the file.
+func (s *FileWatchStore) Save(ctx context.Context, ws *WatchState) error {
+	data, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+
+	return nil
+}
+
+// WatchOption configures Account.Watch.
+type WatchOption func(*watcher)
+
+// WithWatchStore persists the watcher's state in store.
+func WithWatchStore(store WatchStore) WatchOption {
+	return func(w *watcher) {
+		w.store = store
+	}
+}
+
+// WithWatchSince sends a created event for every transaction
+// since the given time when there is no stored state. By default
+// only transactions created after Watch is first called are
+// sent.
+func WithWatchSince(since time.Time) WatchOption {
+	return func(w *watcher) {
+		w.since = since
+	}
+}
+
+// WithWatchLookback sets how far before the newest transaction
+// settled transactions are checked for changes, such as to their
+// notes. Pending transactions are always checked. It defaults to
+// a day.
+func WithWatchLookback(d time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.lookback = d
+	}
+}
+
+// WithWatchErrorHandler is called with the errors from each poll.
+// Polling carries on after an error either way.
+func WithWatchErrorHandler(fn func(error)) WatchOption {
+	return func(w *watcher) {
+		w.onError = fn
+	}
+}
+
+type watcher struct {
+	acc      Account
+	store    WatchStore
+	since    time.Time
+	lookback time.Duration
+	onError  func(error)
+	now      func() time.Time
+}
+
+// Watch polls the Account for transactions every interval, for
+// when webhooks can't reach you. It sends an EventTransactionCreated
+// Event for each new transaction, the same as a WebhookHandler
+// would pass on, so they can be passed to its Dispatch.
+//
+// When a transaction it has already sent settles, changes amount,
+// is declined or has its notes changed, Watch sends an
+// EventTransactionUpdated Event, whose Changes list what changed.
+//
+// Events are sent before the watcher's state is saved, so after
+// a crash some may be sent again. The channel is closed when ctx
+// is done.
+func (a Account) Watch(ctx context.Context, interval time.Duration, opts ...WatchOption) <-chan Event {
+	w := &watcher{
+		acc:      a,
+		store:    &MemoryWatchStore{},
+		lookback: 24 * time.Hour,
+		now:      time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		for {
+			if err := w.poll(ctx, events); err != nil && ctx.Err() == nil && w.onError != nil {
+				w.onError(err)
+			}
+
+			if err := sleep(ctx, interval); err != nil {
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// poll fetches the transactions that may have changed since the
+// last poll and sends an event for each change.
+func (w *watcher) poll(ctx context.Context, events chan<- Event) error {
+	state, err := w.store.Load(ctx)
+	first := false
+	baseline := false
+
+	if errors.Is(err, ErrNoWatchState) {
+		state = &WatchState{HighWater: w.since}
+		first = true
+		if w.since.IsZero() {
+			// Record what's already there without sending
+			// anything, so only new transactions are sent.
+			state.HighWater = w.now().Add(-w.lookback)
+			baseline = true
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if state.Transactions == nil {
+		state.Transactions = make(map[string]WatchedTransaction)
+	}
+
+	since := state.HighWater.Add(-w.lookback)
+	if first {
+		since = state.HighWater
+	}
+
+	for _, t := range state.Transactions {
+		if !t.Settled && !t.Declined && t.Created.Before(since) {
+			since = t.Created
+		}
+	}
+
+	it := w.acc.TransactionIterator(TransactionQuery{Since: since})
+	for it.Next(ctx) {
+		t := it.Transaction()
+
+		// The lookback, and Monzo only taking since to the
+		// second, can return transactions from before
+		// WithWatchSince. They are recorded without being sent.
+		_, known := state.Transactions[t.ID]
+		quiet := baseline || (!known && t.Created.Before(w.since))
+
+		if !quiet {
+			if eventType, fields := changes(state.Transactions, t); eventType != "" {
+				e, err := transactionEvent(eventType, t, w.now())
+				if err != nil {
+					return err
+				}
+				e.Changes = fields
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		state.Transactions[t.ID] = watched(t)
+		if t.Created.After(state.HighWater) {
+			state.HighWater = t.Created
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	// Forget transactions that will no longer be polled for.
+	// Monzo only takes since to the second, so those in the
+	// same second as the cutoff are polled for again and must
+	// be kept, or they would be sent as new.
+	cutoff := state.HighWater.Add(-w.lookback).Truncate(time.Second)
+	for id, t := range state.Transactions {
+		if (t.Settled || t.Declined) && t.Created.Before(cutoff) {
+			delete(state.Transactions, id)
+		}
+	}
+
+	return w.store.Save(ctx, state)
+}
+
+// changes returns the type of the event to send for t, given
+// the last known state of the transactions, and the fields that
+// have changed if it has been seen before. The type is empty if
+// nothing has changed.
+func changes(known map[string]WatchedTransaction, t Transaction) (string, []string) {
+	prev, ok := known[t.ID]
+	if !ok {
+		return EventTransactionCreated, nil
+	}
+
+	var fields []string
+	if t.IsDeclined() && !prev.Declined {
+		fields = append(fields, "decline_reason")
+	}
+	if !t.IsPending() && !prev.Settled && !t.IsDeclined() {
+		fields = append(fields, "settled")
+	}
+	if t.Amount != prev.Amount {
+		fields = append(fields, "amount")
+	}
+	if t.Notes != prev.Notes {
+		fields = append(fields, "notes")
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return EventTransactionUpdated, fields
+}
+
+// transactionEvent builds the Event for a change to t, in the
+// same form as one received by a webhook.
+func transactionEvent(eventType string, t Transaction, received time.Time) (Event, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Type:        eventType,
+		Data:        data,
+		Received:    received,
+		Transaction: t,
+	}, nil
+}
@@ -1,8 +1,167 @@
 package monzo
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
 // Webhook is an endpoint that Monzo will send events to.
 type Webhook struct {
 	ID        string `json:"id"`
 	AccountID string `json:"account_id"`
 	URL       string `json:"url"`
+
+	client *Client
+}
+
+// Delete stops Monzo sending events to the Webhook.
+func (w Webhook) Delete() error {
+	return w.DeleteContext(context.Background())
+}
+
+// DeleteContext is like Delete but uses the passed context for
+// the request.
+func (w Webhook) DeleteContext(ctx context.Context) error {
+	req, err := w.client.NewRequestContext(ctx, http.MethodDelete, "webhooks/"+w.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := w.client.send(req, "", nil); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return nil
+}
+
+// WebhookPlan is the set of changes that bring an Account's
+// webhooks in line with the URLs they should send events to.
+type WebhookPlan struct {
+	// Add is the URLs that have no Webhook yet.
+	Add []string
+
+	// Remove is the Webhooks for URLs that are no longer wanted,
+	// along with any duplicates of the ones in Keep.
+	Remove []Webhook
+
+	// Keep is the Webhooks that are already as they should be.
+	Keep []Webhook
+
+	acc Account
+
+	// added and removed record how much of the plan has been
+	// carried out, so that the plan itself is left as it was.
+	added   []Webhook
+	removed int
+}
+
+// Empty reports whether the plan has no changes to make.
+func (p *WebhookPlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Remove) == 0
+}
+
+// Registered returns the Webhooks that Apply has created so far,
+// in the same order as Add.
+func (p *WebhookPlan) Registered() []Webhook {
+	return p.added
+}
+
+// PlanWebhooks works out how to change the Account's webhooks so
+// that there is exactly one for each of the given URLs, without
+// making any changes. Call Apply on the plan to carry it out.
+func (a Account) PlanWebhooks(urls []string) (*WebhookPlan, error) {
+	return a.PlanWebhooksContext(context.Background(), urls)
+}
+
+// PlanWebhooksContext is like PlanWebhooks but uses the passed
+// context for the request.
+func (a Account) PlanWebhooksContext(ctx context.Context, urls []string) (*WebhookPlan, error) {
+	existing, err := a.WebhooksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	want := make(map[string]bool)
+	for _, u := range urls {
+		want[u] = true
+	}
+
+	p := &WebhookPlan{acc: a}
+	kept := make(map[string]bool)
+
+	for _, w := range existing {
+		if want[w.URL] && !kept[w.URL] {
+			kept[w.URL] = true
+			p.Keep = append(p.Keep, w)
+			continue
+		}
+
+		p.Remove = append(p.Remove, w)
+	}
+
+	for _, u := range urls {
+		if !kept[u] {
+			kept[u] = true
+			p.Add = append(p.Add, u)
+		}
+	}
+
+	return p, nil
+}
+
+// Apply carries out the plan, registering the new webhooks
+// before removing the old ones so that no events are missed.
+//
+// The plan remembers which changes have been made, so if Apply
+// fails part way through it can be called again to finish.
+// Webhooks that have already been deleted are skipped.
+func (p *WebhookPlan) Apply() error {
+	return p.ApplyContext(context.Background())
+}
+
+// ApplyContext is like Apply but uses the passed context for the
+// requests.
+func (p *WebhookPlan) ApplyContext(ctx context.Context) error {
+	for len(p.added) < len(p.Add) {
+		w, err := p.acc.RegisterWebhookContext(ctx, p.Add[len(p.added)])
+		if err != nil {
+			return err
+		}
+
+		p.added = append(p.added, w)
+	}
+
+	for p.removed < len(p.Remove) {
+		if err := p.Remove[p.removed].DeleteContext(ctx); err != nil && !IsNotFound(err) {
+			return err
+		}
+
+		p.removed++
+	}
+
+	return nil
+}
+
+// SyncWebhooks makes sure the Account has exactly one webhook
+// for each of the given URLs, and no others, returning the plan
+// that was applied. Use PlanWebhooks to see the changes without
+// making them.
+func (a Account) SyncWebhooks(urls []string) (*WebhookPlan, error) {
+	return a.SyncWebhooksContext(context.Background(), urls)
+}
+
+// SyncWebhooksContext is like SyncWebhooks but uses the passed
+// context for the requests.
+func (a Account) SyncWebhooksContext(ctx context.Context, urls []string) (*WebhookPlan, error) {
+	p, err := a.PlanWebhooksContext(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.ApplyContext(ctx); err != nil {
+		return p, fmt.Errorf("failed to sync webhooks: %w", err)
+	}
+
+	return p, nil
 }
@@ -0,0 +1,321 @@
+package monzo
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrHandlerClosed is returned when an event arrives at a
+// WebhookHandler that has been closed.
+var ErrHandlerClosed = errors.New("webhook handler closed")
+
+// maxEventSize is the largest webhook body that is accepted.
+const maxEventSize = 1 << 20
+
+// EventFunc handles an Event.
+type EventFunc func(ctx context.Context, e Event) error
+
+// WebhookHandler is an http.Handler that receives the events
+// Monzo sends to a registered webhook.
+//
+// Events are acknowledged as soon as they are decoded, and
+// handled afterwards by a bounded pool of workers. When the
+// pool's queue is full the handler replies 503, so Monzo will
+// deliver the event again later.
+type WebhookHandler struct {
+	secret   string
+	client   *Client
+	workers  int
+	onError  func(Event, error)
+	now      func() time.Time
+	handlers map[string]EventFunc
+	fallback EventFunc
+	store    EventStore
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// WebhookOption configures a WebhookHandler when it is created
+// with NewWebhookHandler.
+type WebhookOption func(*WebhookHandler)
+
+// WithWebhookSecret only accepts events sent to a URL with the
+// given secret in it, as added by WebhookURL.
+func WithWebhookSecret(secret string) WebhookOption {
+	return func(h *WebhookHandler) {
+		h.secret = secret
+	}
+}
+
+// WithWebhookWorkers sets how many events are handled at once,
+// and how many more can wait to be handled. It defaults to 4
+// workers and a queue of 64.
+func WithWebhookWorkers(workers, queue int) WebhookOption {
+	return func(h *WebhookHandler) {
+		if workers > 0 {
+			h.workers = workers
+		}
+		if queue >= 0 {
+			h.queue = make(chan Event, queue)
+		}
+	}
+}
+
+// WithWebhookClient gives the Transactions in events a Client,
+// so that handlers can act on them, such as adding a note.
+func WithWebhookClient(c *Client) WebhookOption {
+	return func(h *WebhookHandler) {
+		h.client = c
+	}
+}
+
+// WithWebhookErrorHandler is called with the errors returned
+// while handling events. They are discarded otherwise.
+func WithWebhookErrorHandler(fn func(Event, error)) WebhookOption {
+	return func(h *WebhookHandler) {
+		h.onError = fn
+	}
+}
+
+// WithEventStore records every event in store before it is
+// acknowledged. Events Monzo delivers more than once are only
+// handled the first time, and the store can be replayed later.
+//
+// An event is marked as queued in the store once it has been
+// handed to the workers, and a delivery of an event that was
+// never queued is handled, whichever handler sharing the store
+// receives it. An event delivered again while it is being
+// queued may be handled twice.
+func WithEventStore(store EventStore) WebhookOption {
+	return func(h *WebhookHandler) {
+		h.store = store
+	}
+}
+
+// NewWebhookHandler creates a WebhookHandler and starts its
+// workers. Call Close to stop them.
+func NewWebhookHandler(opts ...WebhookOption) *WebhookHandler {
+	h := &WebhookHandler{
+		workers:  4,
+		queue:    make(chan Event, 64),
+		now:      time.Now,
+		handlers: make(map[string]EventFunc),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	for i := 0; i < h.workers; i++ {
+		h.wg.Add(1)
+		go h.work()
+	}
+
+	return h
+}
+
+// WebhookURL adds a secret to the URL a webhook is registered
+// with, for a WebhookHandler created WithWebhookSecret to check.
+func WebhookURL(webhook, secret string) (string, error) {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("secret", secret)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Handle sets the function called for events of the given type.
+// Handlers should be set before the WebhookHandler is served.
+func (h *WebhookHandler) Handle(eventType string, fn EventFunc) {
+	h.handlers[eventType] = fn
+}
+
+// HandleTransactionCreated sets the function called with the
+// Transaction in each transaction.created event.
+func (h *WebhookHandler) HandleTransactionCreated(fn func(context.Context, Transaction) error) {
+	h.Handle(EventTransactionCreated, func(ctx context.Context, e Event) error {
+		return fn(ctx, e.Transaction)
+	})
+}
+
+// HandleDefault sets the function called for events that have
+// no handler of their own, so that new event types are not
+// dropped.
+func (h *WebhookHandler) HandleDefault(fn EventFunc) {
+	h.fallback = fn
+}
+
+// ServeHTTP receives an event from Monzo.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.secret != "" {
+		got := r.URL.Query().Get("secret")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEventSize+1))
+	if err != nil {
+		http.Error(w, "failed to read event", http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > maxEventSize {
+		http.Error(w, "event too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	e.Received = h.now()
+
+	if h.store != nil {
+		fresh, err := h.store.Append(r.Context(), e)
+		if err != nil {
+			http.Error(w, "failed to record event", http.StatusInternalServerError)
+			return
+		}
+
+		if !fresh {
+			// A duplicate is only dropped if the first delivery
+			// was queued. Otherwise this is Monzo's retry after
+			// a 503, and it needs handling.
+			queued, err := h.store.Queued(r.Context(), e)
+			if err != nil {
+				http.Error(w, "failed to read event", http.StatusInternalServerError)
+				return
+			}
+
+			if queued {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+	}
+
+	if err := h.enqueue(e); err != nil {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	if h.store != nil {
+		// The event is already queued, so it is acknowledged
+		// even if the mark can't be saved. The worst outcome is
+		// that a later duplicate is handled again.
+		if err := h.store.MarkQueued(r.Context(), e); err != nil && h.onError != nil {
+			h.onError(e, fmt.Errorf("failed to mark event queued: %w", err))
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// enqueue hands e to the workers, failing rather than waiting if
+// they are all busy.
+func (h *WebhookHandler) enqueue(e Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrHandlerClosed
+	}
+
+	select {
+	case h.queue <- e:
+		return nil
+	default:
+		return errors.New("webhook queue is full")
+	}
+}
+
+func (h *WebhookHandler) work() {
+	defer h.wg.Done()
+
+	for e := range h.queue {
+		if err := h.Dispatch(h.ctx, e); err != nil && h.onError != nil {
+			h.onError(e, err)
+		}
+	}
+}
+
+// Dispatch calls the handler for the event's type, or the
+// default handler if it has none. It runs in the calling
+// goroutine, so it can be used to handle events from elsewhere,
+// such as those replayed from an EventStore:
+//
+//	store.Replay(ctx, since, h.Dispatch)
+func (h *WebhookHandler) Dispatch(ctx context.Context, e Event) error {
+	if isTransactionEvent(e.Type) && h.client != nil {
+		e.Transaction.setClient(h.client)
+	}
+
+	fn, ok := h.handlers[e.Type]
+	if !ok {
+		fn = h.fallback
+	}
+
+	if fn == nil {
+		return nil
+	}
+
+	return fn(ctx, e)
+}
+
+// Close stops accepting events and waits for the queued ones to
+// be handled, or for ctx to be done. Handlers still running when
+// ctx is done have their context cancelled.
+func (h *WebhookHandler) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		h.cancel()
+		return nil
+	case <-ctx.Done():
+		h.cancel()
+		return ctx.Err()
+	}
+}
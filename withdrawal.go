@@ -1,8 +1,7 @@
 package monzo
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"net/http"
 )
 
@@ -11,23 +10,33 @@ import (
 // effects if the withdrawal is not ran.
 type Withdrawal struct {
 	Request *http.Request
-	Client  *http.Client
-}
 
-// Run executes the withdrawal against the Monzo API. An error is
-// only returned if the withdrawal fails to run. If the action
-// has already ran against the account, it is not ran again
-// and an error is not returned.
-func (d Withdrawal) Run() error {
-	resp, _ := d.Client.Do(d.Request)
+	// Client sends the request when the Withdrawal wasn't created
+	// by an Account.
+	//
+	// Deprecated: create the Withdrawal with Account.Withdraw, which
+	// uses the Account's Client.
+	Client *http.Client
+
+	// DedupeID is the dedupe ID sent with the request.
+	DedupeID string
 
-	b := new(bytes.Buffer)
-	b.ReadFrom(resp.Body)
-	str := b.String()
+	client *Client
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to withdraw: %s", str)
-	}
+// Run executes the withdrawal against the Monzo API, returning
+// the Pot as it is afterwards. An error is only returned if the
+// withdrawal fails to run. If the action has already ran against
+// the account, it is not ran again and an error is not returned.
+//
+// Run can be called again, for example after an error, and sends
+// the same request each time.
+func (d Withdrawal) Run() (*PotResult, error) {
+	return d.RunContext(context.Background())
+}
 
-	return nil
+// RunContext is like Run but uses the passed context for the
+// request.
+func (d Withdrawal) RunContext(ctx context.Context) (*PotResult, error) {
+	return potClient(d.client, d.Client).runPotRequest(ctx, d.Request, d.DedupeID, "withdraw")
 }